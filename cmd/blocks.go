@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+)
+
+// kube2iamOutcome represents the outcome of a kube2iam request or approval
+type kube2iamOutcome struct {
+	Title     string
+	RequestID string
+	Requester string
+	Namespace string
+	RoleArn   string
+	Cluster   string
+	Owners    []string
+	Result    string
+	// Actions are shown as buttons below the outcome
+	Actions []types.BlockElement
+}
+
+// blocks renders the outcome as Block Kit blocks
+func (o kube2iamOutcome) blocks() []types.Block {
+	blocks := []types.Block{
+		types.NewHeaderBlock(o.Title),
+		types.NewSectionBlock("",
+			fmt.Sprintf("*Namespace*\n%s", o.Namespace),
+			fmt.Sprintf("*Cluster*\n%s", o.Cluster),
+			fmt.Sprintf("*Role ARN*\n`%s`", o.RoleArn)),
+	}
+	if o.RequestID != "" {
+		blocks[1].Fields = append(blocks[1].Fields, &types.TextObject{Type: types.Markdown, Text: fmt.Sprintf("*Request ID*\n%s", o.RequestID)})
+	}
+	if o.Requester != "" {
+		blocks[1].Fields = append(blocks[1].Fields, &types.TextObject{Type: types.Markdown, Text: fmt.Sprintf("*Requested by*\n<@%s>", o.Requester)})
+	}
+	if len(o.Owners) > 0 {
+		blocks = append(blocks, types.NewSectionBlock(fmt.Sprintf("*Owners*\n• %s", strings.Join(o.Owners, "\n• "))))
+	}
+	if o.Result != "" {
+		blocks = append(blocks, types.NewDividerBlock(), types.NewSectionBlock(o.Result))
+	}
+	if len(o.Actions) > 0 {
+		blocks = append(blocks, types.NewActionsBlock(types.Kube2IamRequestBlockID, o.Actions...))
+	}
+	return blocks
+}
+
+// response returns a Response showing the outcome, with text as the notification and fallback text
+func (o kube2iamOutcome) response(text string) Response {
+	return Response{Text: text, Blocks: o.blocks()}
+}
+
+// kube2iamRequestButtons returns the Approve and Deny buttons of the pending kube2iam request reqID
+func kube2iamRequestButtons(reqID string) []types.BlockElement {
+	return []types.BlockElement{
+		types.NewButton(types.ApproveKube2IamAction, "Approve", reqID, types.PrimaryStyle),
+		types.NewButton(types.DenyKube2IamAction, "Deny", reqID, types.DangerStyle),
+	}
+}
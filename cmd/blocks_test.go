@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKube2IamOutcomeBlocks(t *testing.T) {
+	Convey("kube2iamOutcome.blocks", t, func() {
+		outcome := kube2iamOutcome{
+			Title:     "kube2iam request pending approval",
+			Namespace: "foo",
+			RoleArn:   "arn:aws:iam::123456789012:role/superawesome-powerful-Role3",
+			Cluster:   "hydrogen",
+		}
+		Convey("should show the namespace, cluster and role ARN under the title", func() {
+			actual := outcome.blocks()
+			So(actual, ShouldHaveLength, 2)
+			So(actual[0], ShouldResemble, types.NewHeaderBlock("kube2iam request pending approval"))
+			So(actual[1].Fields, ShouldHaveLength, 3)
+			So(actual[1].Fields[0].Text, ShouldEqual, "*Namespace*\nfoo")
+			So(actual[1].Fields[1].Text, ShouldEqual, "*Cluster*\nhydrogen")
+			So(actual[1].Fields[2].Text, ShouldEqual, "*Role ARN*\n`arn:aws:iam::123456789012:role/superawesome-powerful-Role3`")
+		})
+		Convey("should identify the pending request and its requester", func() {
+			outcome.RequestID = "7"
+			outcome.Requester = "UCRAY7Q"
+			actual := outcome.blocks()
+			So(actual[1].Fields, ShouldHaveLength, 5)
+			So(actual[1].Fields[3].Text, ShouldEqual, "*Request ID*\n7")
+			So(actual[1].Fields[4].Text, ShouldEqual, "*Requested by*\n<@UCRAY7Q>")
+		})
+		Convey("should list owners and the result when present", func() {
+			outcome.Owners = []string{"john.doe@johndoe.com", "jane.doe@johndoe.com"}
+			outcome.Result = "Please have one of the owners approve"
+			actual := outcome.blocks()
+			So(actual, ShouldHaveLength, 5)
+			So(actual[2].Text.Text, ShouldEqual, "*Owners*\n• john.doe@johndoe.com\n• jane.doe@johndoe.com")
+			So(actual[3].Type, ShouldEqual, types.DividerBlock)
+			So(actual[4].Text.Text, ShouldEqual, "Please have one of the owners approve")
+		})
+		Convey("should end with Approve and Deny buttons of a pending request", func() {
+			outcome.Actions = kube2iamRequestButtons("7")
+			actual := outcome.blocks()
+			actions := actual[len(actual)-1]
+			So(actions.Type, ShouldEqual, types.ActionsBlock)
+			So(actions.BlockID, ShouldEqual, types.Kube2IamRequestBlockID)
+			So(actions.Elements, ShouldHaveLength, 2)
+			So(actions.Elements[0].ActionID, ShouldEqual, types.ApproveKube2IamAction)
+			So(actions.Elements[1].ActionID, ShouldEqual, types.DenyKube2IamAction)
+			So(actions.Elements[0].Value, ShouldEqual, "7")
+			So(actions.Elements[1].Value, ShouldEqual, "7")
+		})
+		Convey("should keep the text as the fallback of the response", func() {
+			actual := outcome.response("fallback")
+			So(actual.Text, ShouldEqual, "fallback")
+			So(actual.Blocks, ShouldResemble, outcome.blocks())
+			So(actual.Broadcast, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/cache"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+)
+
+// Sources of the lookups the bot caches, which name them in !flushCache
+const (
+	accountsCache = "accounts"
+	teamsCache    = "teams"
+	groupsCache   = "groups"
+	usersCache    = "users"
+)
+
+// LookupTTLs are how long the bot keeps the results of each kind of lookup, not keeping them when zero
+type LookupTTLs struct {
+	// Accounts is how long the team owning an AWS account is kept
+	Accounts time.Duration
+	// Teams is how long the AD security group of a team is kept
+	Teams time.Duration
+	// Groups is how long the members of an AD security group are kept
+	Groups time.Duration
+	// Users is how long the AD user of a Slack user is kept
+	Users time.Duration
+	// Failures is how long failed lookups of any kind are kept
+	Failures time.Duration
+}
+
+// DefaultLookupTTLs keep account and team ownership, which rarely changes, longer than group membership
+var DefaultLookupTTLs = LookupTTLs{
+	Accounts: time.Hour,
+	Teams:    time.Hour,
+	Groups:   10 * time.Minute,
+	Users:    10 * time.Minute,
+	Failures: time.Minute,
+}
+
+// LookupCache keeps the results of the metadata server and directory lookups made to authorize requests
+type LookupCache struct {
+	accounts *cache.Cache[string]
+	teams    *cache.Cache[string]
+	groups   *cache.Cache[[]types.ADUser]
+	users    *cache.Cache[types.ADUser]
+}
+
+// NewLookupCache creates a LookupCache keeping lookups for ttls
+func NewLookupCache(ttls LookupTTLs) *LookupCache {
+	return &LookupCache{
+		accounts: cache.New[string](ttls.Accounts, ttls.Failures),
+		teams:    cache.New[string](ttls.Teams, ttls.Failures),
+		groups:   cache.New[[]types.ADUser](ttls.Groups, ttls.Failures),
+		users:    cache.New[types.ADUser](ttls.Users, ttls.Failures),
+	}
+}
+
+// flusher forgets cached lookups
+type flusher interface {
+	Delete(key string) bool
+	Flush() int
+}
+
+// sources returns the caches of c by the names !flushCache knows them by
+func (c *LookupCache) sources() map[string]flusher {
+	return map[string]flusher{accountsCache: c.accounts, teamsCache: c.teams, groupsCache: c.groups, usersCache: c.users}
+}
+
+// Flush forgets the cached lookups of source, or of every source when it is empty, returning how many it forgot.
+// When key is given only the lookup of key is forgotten.
+func (c *LookupCache) Flush(source, key string) (int, error) {
+	sources := c.sources()
+	if source == "" {
+		n := 0
+		for _, f := range sources {
+			n += f.Flush()
+		}
+		return n, nil
+	}
+	f, ok := sources[source]
+	if !ok {
+		names := make([]string, 0, len(sources))
+		for name := range sources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return 0, fmt.Errorf("there is no %s cache, the caches are %s", source, strings.Join(names, ", "))
+	}
+	if key == "" {
+		return f.Flush(), nil
+	}
+	if source == groupsCache {
+		key = strings.ToLower(key)
+	}
+	if f.Delete(key) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// lookupAccountOwnerID returns the ID of the team that owns the AWS account awsAccNum
+func (b *Bot) lookupAccountOwnerID(ctx context.Context, mdsURL, mdsAPIKey, awsAccNum string) (string, error) {
+	return b.Lookups.accounts.Get(ctx, awsAccNum, func(ctx context.Context) (string, error) {
+		return getAWSAccountOwnerID(ctx, mdsURL, mdsAPIKey, awsAccNum)
+	})
+}
+
+// lookupTeamADSecurityGroup returns the AD security group of the team ownerTeamID
+func (b *Bot) lookupTeamADSecurityGroup(ctx context.Context, mdsURL, mdsAPIKey, ownerTeamID string) (string, error) {
+	return b.Lookups.teams.Get(ctx, ownerTeamID, func(ctx context.Context) (string, error) {
+		return getOwnerADSecurityGroup(ctx, mdsURL, mdsAPIKey, ownerTeamID)
+	})
+}
+
+// lookupGroupMembers returns the users in the AD group and in the groups nested in it
+func (b *Bot) lookupGroupMembers(ctx context.Context, group string) ([]types.ADUser, error) {
+	return b.Lookups.groups.Get(ctx, strings.ToLower(group), func(ctx context.Context) ([]types.ADUser, error) {
+		return b.Identity.GroupMembers(ctx, group)
+	})
+}
+
+// FlushCacheReq forgets cached lookups on behalf of one of the bot's admins
+func (b *Bot) FlushCacheReq(botReqParams types.BotReqParams) Response {
+	if !b.isAdmin(botReqParams.SlackUser) {
+		resp := fmt.Sprintf("User <@%s> is not allowed to flush the bot's caches", botReqParams.SlackUser)
+		glog.Errorf(resp)
+		return Response{Text: resp}
+	}
+	var source, key string
+	if len(botReqParams.Fields) > 2 {
+		source = botReqParams.Fields[2]
+	}
+	// keys are the rest of the message, since group names may have spaces
+	if len(botReqParams.Fields) > 3 {
+		key = strings.Join(botReqParams.Fields[3:], " ")
+	}
+
+	n, err := b.Lookups.Flush(source, key)
+	if err != nil {
+		return Response{Text: fmt.Sprintf("Failed to flush the cache. err=%s", err.Error())}
+	}
+	glog.Infof("<@%s> flushed %d cached lookups, source=[%s] key=[%s]\n", botReqParams.SlackUser, n, source, key)
+	return Response{Text: fmt.Sprintf("Flushed %d cached lookups", n)}
+}
+
+// isAdmin reports whether the Slack user slackUID is one of the bot's admins
+func (b *Bot) isAdmin(slackUID string) bool {
+	for _, admin := range b.Admins {
+		if admin == slackUID {
+			return true
+		}
+	}
+	return false
+}
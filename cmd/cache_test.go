@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/ashish-amarnath/slackbots/pkg/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingHandler counts the requests for each path it passes on to next
+type countingHandler struct {
+	next  http.Handler
+	lock  sync.Mutex
+	paths map[string]int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	h.paths[r.URL.Path]++
+	h.lock.Unlock()
+	h.next.ServeHTTP(w, r)
+}
+
+func (h *countingHandler) count(path string) int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.paths[path]
+}
+
+func TestLookupCache(t *testing.T) {
+	Convey("A bot looking up the owners of a role", t, func() {
+		lookups := newOwnerLookupServer(map[string]types.ADUser{
+			"Doe, John": {FirstName: "John", LastName: "Doe", Email: "john.doe@johndoe.com"},
+		})
+		defer lookups.Close()
+		h := &countingHandler{next: lookups.Config.Handler, paths: make(map[string]int)}
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+		fake := slack.NewFakeTransport("UBOT")
+		fake.AddUser(newTestSlackUser("UOWNER", "John", "Doe", "john.doe@johndoe.com"))
+		fake.AddUser(newTestSlackUser("UADMIN", "Ada", "Min", "ada.min@johndoe.com"))
+		bot := NewBot(fake, nil, srv.URL+"/groups", srv.URL, "blahziblahziblah", "", srv.URL+"/users")
+		bot.Admins = []string{"UADMIN"}
+		ctx := context.Background()
+		role := "arn:aws:iam::123456789012:role/superawesome-powerful-Role3"
+		flush := func(user, msg string) Response {
+			return bot.FlushCacheReq(utils.GetBotReqParams("", "", "", "", "", msg, user))
+		}
+
+		Convey("should look each of them up once", func() {
+			for i := 0; i < 3; i++ {
+				owners, err := bot.getRoleOwners(ctx, srv.URL, "blahziblahziblah", role)
+				So(err, ShouldBeNil)
+				So(ownerNames(owners), ShouldResemble, []string{"Doe, John"})
+				_, err = bot.getADUserForSlackUser(ctx, "UOWNER")
+				So(err, ShouldBeNil)
+			}
+			So(h.count("/dev_read/accounts"), ShouldEqual, 1)
+			So(h.count("/dev_read/teams"), ShouldEqual, 1)
+			So(h.count("/groups/team-42-owners"), ShouldEqual, 1)
+			So(h.count("/users/Doe, John"), ShouldEqual, 2)
+		})
+		Convey("should look up users that weren't found again only once the failure expires", func() {
+			fake.AddUser(newTestSlackUser("UCRAY7Q", "Cray", "Cray", "cray.cray@johndoe.com"))
+			_, err := bot.getADUserForSlackUser(ctx, "UCRAY7Q")
+			So(err, ShouldNotBeNil)
+			_, err = bot.getADUserForSlackUser(ctx, "UCRAY7Q")
+			So(err, ShouldNotBeNil)
+			So(h.count("/users/Cray, Cray"), ShouldEqual, 1)
+		})
+		Convey("should look them up again once an admin flushes the cache", func() {
+			bot.getRoleOwners(ctx, srv.URL, "blahziblahziblah", role)
+
+			So(flush("UOWNER", "<@UBOT> !flushCache").Text, ShouldEqual, "User <@UOWNER> is not allowed to flush the bot's caches")
+			bot.getRoleOwners(ctx, srv.URL, "blahziblahziblah", role)
+			So(h.count("/groups/team-42-owners"), ShouldEqual, 1)
+
+			So(flush("UADMIN", "<@UBOT> !flushCache groups TEAM-42-owners").Text, ShouldEqual, "Flushed 1 cached lookups")
+			bot.getRoleOwners(ctx, srv.URL, "blahziblahziblah", role)
+			So(h.count("/groups/team-42-owners"), ShouldEqual, 2)
+			So(h.count("/dev_read/teams"), ShouldEqual, 1)
+
+			So(flush("UADMIN", "<@UBOT> !flushCache teams").Text, ShouldEqual, "Flushed 1 cached lookups")
+			So(flush("UADMIN", "<@UBOT> !flushCache").Text, ShouldEqual, "Flushed 2 cached lookups")
+			bot.getRoleOwners(ctx, srv.URL, "blahziblahziblah", role)
+			So(h.count("/dev_read/accounts"), ShouldEqual, 2)
+			So(h.count("/dev_read/teams"), ShouldEqual, 2)
+		})
+		Convey("should refuse to flush caches it doesn't have", func() {
+			So(flush("UADMIN", "<@UBOT> !flushCache namespaces").Text, ShouldEqual, "Failed to flush the cache. err=there is no namespaces cache, the caches are accounts, groups, teams, users")
+		})
+	})
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/slacktest"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBotEndToEnd(t *testing.T) {
+	Convey("The bot running against a fake slack", t, func() {
+		srv := slacktest.NewServer("UBOT")
+		defer srv.Close()
+		slack.APIBaseURL = srv.APIURL
+		defer func() { slack.APIBaseURL = types.SlackWebAPIURL }()
+
+		conn, err := slack.NewSlackServerConn("xoxb-unit-test")
+		So(err, ShouldBeNil)
+		bot := NewBot(conn, nil, "", "", "", "", "")
+		stopped := make(chan error, 1)
+		go func() { stopped <- bot.Run(conn) }()
+
+		Convey("should answer a help request in its thread", func() {
+			ts := srv.MentionBotAs("UCRAY7Q", "C1", "!help")
+			reply, err := srv.WaitForReply(5 * time.Second)
+			So(err, ShouldBeNil)
+			So(reply.Channel, ShouldEqual, "C1")
+			So(reply.ThreadTs, ShouldEqual, ts)
+			So(reply.Text, ShouldEqual, getSupportedRequestTypes())
+		})
+		Convey("should ignore messages not addressed to it", func() {
+			srv.SendMessageAs("UCRAY7Q", "C1", "!help")
+			_, err := srv.WaitForReply(200 * time.Millisecond)
+			So(err, ShouldNotBeNil)
+		})
+
+		conn.Close()
+		So(<-stopped, ShouldEqual, slack.ErrConnClosed)
+	})
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/ashish-amarnath/slackbots/pkg/utils"
+	"github.com/golang/glog"
+)
+
+// processInteractions processes each interaction read from interactions concurrently until done is closed
+func (b *Bot) processInteractions(interactions <-chan types.InteractionCallback, done <-chan struct{}) {
+	for {
+		select {
+		case ic := <-interactions:
+			go b.ProcessInteraction(ic)
+		case <-done:
+			return
+		}
+	}
+}
+
+// ProcessInteraction processes a click on the Approve or Deny button of a pending kube2iam request, giving up on it after RequestTimeout.
+// Clicks by users who don't own the role are answered with a message only they can see.
+func (b *Bot) ProcessInteraction(ic types.InteractionCallback) {
+	ctx, cancel := b.requestContext()
+	defer cancel()
+
+	if ic.Type != types.BlockActionsType {
+		glog.V(4).Infof("Ignoring %s interaction from user %s\n", ic.Type, ic.User.ID)
+		return
+	}
+	for _, action := range ic.Actions {
+		switch action.ActionID {
+		case types.ApproveKube2IamAction, types.DenyKube2IamAction:
+			b.processKube2IamAction(ctx, ic, action.ActionID, action.Value)
+		default:
+			glog.V(4).Infof("Ignoring action %s from user %s\n", action.ActionID, ic.User.ID)
+		}
+	}
+}
+
+// processKube2IamAction approves or denies the pending kube2iam request reqID on behalf of the user who clicked,
+// and replaces the buttons of the request message with the outcome
+func (b *Bot) processKube2IamAction(ctx context.Context, ic types.InteractionCallback, actionID, reqID string) {
+	msg := fmt.Sprintf("<@%s> %s %s", b.botUserID, types.ApproveKube2IamBotReq, reqID)
+	botReqParams := utils.GetBotReqParams(b.ADGroupLookupURL, b.ADUserLookupURL, b.AWSMetadataServerURL, b.AWSAPIKey, b.KubeConfig, msg, ic.User.ID)
+	if !isApprovalValid(botReqParams) {
+		glog.Errorf("Ignoring %s action with malformed request ID [%s] from user %s\n", actionID, reqID, ic.User.ID)
+		return
+	}
+	glog.V(1).Infof("Received %s action %s\n", actionID, utils.StringifyBotReqParams(botReqParams))
+
+	resp, ok := b.decideKube2IamReq(ctx, botReqParams, reqID, actionID == types.ApproveKube2IamAction)
+	// leave the buttons in place when the click was rejected or failed, so an owner can try again
+	if !ok {
+		if err := b.Responder.SendEphemeral(ic.Channel.ID, ic.User.ID, resp.Text); err != nil {
+			glog.Errorf("Failed to tell user %s their %s action failed. err=%s\n", ic.User.ID, actionID, err.Error())
+		}
+		return
+	}
+	update := types.Message{Channel: ic.Channel.ID, Ts: ic.Message.Ts, Text: resp.Text, Blocks: resp.Blocks}
+	if err := b.Responder.UpdateMessage(update); err != nil {
+		glog.Errorf("Failed to update request message %s in channel %s. err=%s\n", ic.Message.Ts, ic.Channel.ID, err.Error())
+	}
+}
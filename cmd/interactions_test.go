@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/identity"
+	"github.com/ashish-amarnath/slackbots/pkg/k8stest"
+	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/store"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newOwnerLookupServer serves the metadata server and AD lookups used to find role owners.
+// Every AWS account is owned by a team whose AD security group has the members in users, keyed by "Last, First".
+func newOwnerLookupServer(users map[string]types.ADUser) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/"+strings.Split(types.AWSMetaDataServerAccRsrcEp, "?")[0]:
+			w.Write([]byte(`{"data":[{"OwnerTeamId":42}]}`))
+		case r.URL.Path == "/"+strings.Split(types.ADSecurityGroupEndPoint, "?")[0]:
+			w.Write([]byte(`{"data":[{"ADSecurityGroup":"team-42-owners"}]}`))
+		case r.URL.Path == "/groups/team-42-owners":
+			var resp types.ADGroupMemberListResp
+			for cn := range users {
+				resp.Members.Users = append(resp.Members.Users, cn)
+			}
+			json.NewEncoder(w).Encode(resp)
+		case strings.HasPrefix(r.URL.Path, "/users/"):
+			usr, ok := users[strings.TrimPrefix(r.URL.Path, "/users/")]
+			if !ok {
+				w.Write([]byte(`{}`))
+				return
+			}
+			json.NewEncoder(w).Encode(usr)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// slowIdentity resolves slack users only after delay, like a directory under load
+type slowIdentity struct {
+	identity.Provider
+	delay time.Duration
+}
+
+func (p slowIdentity) ResolveSlackUser(ctx context.Context, su types.SlackUser) (types.ADUser, error) {
+	time.Sleep(p.delay)
+	return p.Provider.ResolveSlackUser(ctx, su)
+}
+
+func newTestSlackUser(id, firstName, lastName, email string) types.SlackUser {
+	var usr types.SlackUser
+	usr.ID = id
+	usr.Profile.FirstName = firstName
+	usr.Profile.LastName = lastName
+	usr.Profile.Email = email
+	return usr
+}
+
+func newTestInteraction(actionID, value, user string) types.InteractionCallback {
+	var ic types.InteractionCallback
+	ic.Type = types.BlockActionsType
+	ic.User.ID = user
+	ic.Channel.ID = "C1"
+	ic.Message.Ts = "1503435956.000300"
+	ic.Actions = append(ic.Actions, struct {
+		ActionID string `json:"action_id"`
+		BlockID  string `json:"block_id"`
+		Value    string `json:"value"`
+		Type     string `json:"type"`
+	}{ActionID: actionID, BlockID: types.Kube2IamRequestBlockID, Value: value, Type: types.ButtonType})
+	return ic
+}
+
+func TestProcessInteraction(t *testing.T) {
+	Convey("ProcessInteraction", t, func() {
+		srv := newOwnerLookupServer(map[string]types.ADUser{
+			"Doe, John": {FirstName: "John", LastName: "Doe", Email: "john.doe@johndoe.com"},
+		})
+		defer srv.Close()
+		fake := slack.NewFakeTransport("UBOT")
+		fake.AddUser(newTestSlackUser("UOWNER", "John", "Doe", "john.doe@johndoe.com"))
+		fake.AddUser(newTestSlackUser("UCRAY7Q", "Cray", "Cray", "cray.cray@johndoe.com"))
+		bot := NewBot(fake, newTestStore(t), srv.URL+"/groups", srv.URL, "blahziblahziblah", "/User/craycrayuser/.kube/config", srv.URL+"/users")
+		bot.botUserID = "UBOT"
+		bot.Kube = newTestKube(`["arn:aws:iam::123456789012:role/one"]`)
+		pending, err := bot.Store.Add(types.Kube2IamRequest{
+			Requester: "UCRAY7Q",
+			Namespace: "foo",
+			RoleArn:   "arn:aws:iam::123456789012:role/superawesome-powerful-Role3",
+			Cluster:   "hydrogen",
+			Owners:    []string{"Doe, John"},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("should reject clicks from users it can't find in AD with an ephemeral message", func() {
+			bot.ProcessInteraction(newTestInteraction(types.ApproveKube2IamAction, pending.ID, "UCRAY7Q"))
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Ephemeral, ShouldBeTrue)
+			So(replies[0].User, ShouldEqual, "UCRAY7Q")
+			So(replies[0].Text, ShouldStartWith, "Unable to find the AD user of <@UCRAY7Q> to check they own role")
+			_, err := bot.Store.Get(pending.ID)
+			So(err, ShouldBeNil)
+		})
+		Convey("should update the request message and forget the request when an owner denies it", func() {
+			bot.ProcessInteraction(newTestInteraction(types.DenyKube2IamAction, pending.ID, "UOWNER"))
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Updated, ShouldBeTrue)
+			So(replies[0].Channel, ShouldEqual, "C1")
+			So(replies[0].Ts, ShouldEqual, "1503435956.000300")
+			So(replies[0].Blocks[0].Text.Text, ShouldEqual, "kube2iam request denied")
+			for _, block := range replies[0].Blocks {
+				So(block.Type, ShouldNotEqual, types.ActionsBlock)
+			}
+			_, err := bot.Store.Get(pending.ID)
+			So(err, ShouldEqual, store.ErrRequestNotFound)
+		})
+		Convey("should update the request message, allow the role and forget the request when an owner approves it", func() {
+			bot.ProcessInteraction(newTestInteraction(types.ApproveKube2IamAction, pending.ID, "UOWNER"))
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Updated, ShouldBeTrue)
+			So(replies[0].Blocks[0].Text.Text, ShouldEqual, "kube2iam role approved")
+			_, err := bot.Store.Get(pending.ID)
+			So(err, ShouldEqual, store.ErrRequestNotFound)
+
+			ns, err := bot.Kube.GetNamespace(context.Background(), "hydrogen", "foo")
+			So(err, ShouldBeNil)
+			So(ns.Metadata.Annotations.Kube2IamAllowedRoles, ShouldEqual, `["arn:aws:iam::123456789012:role/one","arn:aws:iam::123456789012:role/superawesome-powerful-Role3"]`)
+			So(ns.Metadata.Annotations.CloudTeamID, ShouldEqual, "42")
+		})
+		Convey("should keep the buttons and the request, and tell the owner, when approving fails", func() {
+			bot.Kube = k8stest.NewClient(nil)
+			bot.ProcessInteraction(newTestInteraction(types.ApproveKube2IamAction, pending.ID, "UOWNER"))
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Ephemeral, ShouldBeTrue)
+			So(replies[0].User, ShouldEqual, "UOWNER")
+			So(replies[0].Text, ShouldStartWith, "Failed to get namespace definition for namepsace=foo")
+			_, err := bot.Store.Get(pending.ID)
+			So(err, ShouldBeNil)
+		})
+		Convey("should carry out only one of concurrent decisions", func() {
+			var wg sync.WaitGroup
+			for _, action := range []string{types.ApproveKube2IamAction, types.DenyKube2IamAction} {
+				wg.Add(1)
+				go func(action string) {
+					defer wg.Done()
+					bot.ProcessInteraction(newTestInteraction(action, pending.ID, "UOWNER"))
+				}(action)
+			}
+			wg.Wait()
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 2)
+			updated := 0
+			for _, reply := range replies {
+				if reply.Updated {
+					updated++
+				} else {
+					So(reply.Ephemeral, ShouldBeTrue)
+					So(reply.Text, ShouldBeIn, []string{
+						"kube2iam request " + pending.ID + " was already decided",
+						"There is no pending kube2iam request with ID " + pending.ID,
+					})
+				}
+			}
+			So(updated, ShouldEqual, 1)
+			_, err := bot.Store.Get(pending.ID)
+			So(err, ShouldEqual, store.ErrRequestNotFound)
+		})
+		Convey("should refuse requests that expire while their owners are looked up, leaving them to expire", func() {
+			bot.RequestTTL = time.Hour
+			bot.Identity = slowIdentity{Provider: bot.Identity, delay: 300 * time.Millisecond}
+			expiring, err := bot.Store.Add(types.Kube2IamRequest{
+				Requester: "UCRAY7Q",
+				Namespace: "foo",
+				RoleArn:   "arn:aws:iam::123456789012:role/superawesome-powerful-Role3",
+				Cluster:   "hydrogen",
+				Owners:    []string{"Doe, John"},
+				CreatedAt: time.Now().Add(100*time.Millisecond - time.Hour),
+			})
+			So(err, ShouldBeNil)
+
+			bot.ProcessInteraction(newTestInteraction(types.ApproveKube2IamAction, expiring.ID, "UOWNER"))
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Ephemeral, ShouldBeTrue)
+			So(replies[0].Text, ShouldEqual, "kube2iam request "+expiring.ID+" expired after 1h0m0s without being approved")
+			_, err = bot.Store.Get(expiring.ID)
+			So(err, ShouldBeNil)
+
+			ns, err := bot.Kube.GetNamespace(context.Background(), "hydrogen", "foo")
+			So(err, ShouldBeNil)
+			So(ns.Metadata.Annotations.Kube2IamAllowedRoles, ShouldEqual, `["arn:aws:iam::123456789012:role/one"]`)
+		})
+		Convey("should tell the user when the request is no longer pending", func() {
+			bot.ProcessInteraction(newTestInteraction(types.ApproveKube2IamAction, "42", "UOWNER"))
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Ephemeral, ShouldBeTrue)
+			So(replies[0].Text, ShouldEqual, "There is no pending kube2iam request with ID 42")
+		})
+		Convey("should ignore malformed button values", func() {
+			bot.ProcessInteraction(newTestInteraction(types.ApproveKube2IamAction, "foo bar", "UOWNER"))
+			So(fake.Replies(), ShouldBeEmpty)
+		})
+		Convey("should ignore other interactions", func() {
+			ic := newTestInteraction(types.ApproveKube2IamAction, pending.ID, "UOWNER")
+			ic.Type = "view_submission"
+			bot.ProcessInteraction(ic)
+			So(fake.Replies(), ShouldBeEmpty)
+		})
+	})
+}
@@ -1,18 +1,78 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/ashish-amarnath/slackbots/pkg/httpclient"
+	"github.com/ashish-amarnath/slackbots/pkg/identity"
+	"github.com/ashish-amarnath/slackbots/pkg/k8s"
+	"github.com/ashish-amarnath/slackbots/pkg/kube2iam"
 	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/store"
 	"github.com/ashish-amarnath/slackbots/pkg/types"
 	"github.com/ashish-amarnath/slackbots/pkg/utils"
 	"github.com/golang/glog"
 )
 
+// LookupClient makes the requests to the AWS metadata server and the AD lookup services, main replaces it to apply the lookup flags
+var LookupClient = httpclient.Default()
+
+// Bot processes requests sent to the slackbot and responds to them over slack
+type Bot struct {
+	Responder            slack.Responder
+	Store                store.RequestStore
+	ADGroupLookupURL     string
+	ADUserLookupURL      string
+	AWSMetadataServerURL string
+	AWSAPIKey            string
+	KubeConfig           string
+	// Kube reads and patches the namespaces of the clusters in KubeConfig
+	Kube k8s.NamespaceClient
+	// Identity maps Slack users to directory users and lists the owners in directory groups
+	Identity identity.Provider
+	// Clusters are the kubeconfig contexts searched by queries that span clusters, all of them when empty
+	Clusters []string
+	// RequestTTL is how long kube2iam requests wait for approval, forever when zero
+	RequestTTL time.Duration
+	// ReminderInterval is how often owners are reminded of pending requests, never when zero
+	ReminderInterval time.Duration
+	// RequestTimeout is how long the bot works on a request before giving up, forever when zero
+	RequestTimeout time.Duration
+	// Lookups caches the owners of accounts, teams and groups, and the AD users of Slack users
+	Lookups *LookupCache
+	// Admins are the Slack users allowed to run admin requests like !flushCache
+	Admins []string
+
+	// botUserID is the slack user the bot runs as, set by Run
+	botUserID string
+	// namespaceLocks serializes updates to each namespace, keyed by cluster and namespace
+	namespaceLocks keyedMutex
+}
+
+// NewBot creates a Bot that responds to requests with r and records pending kube2iam requests in s
+func NewBot(r slack.Responder, s store.RequestStore, adGroupLookupURL, metadataServerURL, metadataServerAPIKey, kubeconfig, adUsrLookupURL string) *Bot {
+	return &Bot{
+		Responder:            r,
+		Store:                s,
+		ADGroupLookupURL:     adGroupLookupURL,
+		ADUserLookupURL:      adUsrLookupURL,
+		AWSMetadataServerURL: metadataServerURL,
+		AWSAPIKey:            metadataServerAPIKey,
+		KubeConfig:           kubeconfig,
+		Kube:                 k8s.NewClient(kubeconfig),
+		Identity:             identity.NewREST(LookupClient, adGroupLookupURL, adUsrLookupURL),
+		RequestTTL:           DefaultRequestTTL,
+		ReminderInterval:     DefaultReminderInterval,
+		RequestTimeout:       DefaultRequestTimeout,
+		Lookups:              NewLookupCache(DefaultLookupTTLs),
+	}
+}
+
 func getAccNumFromRoleArn(arnName string) (accNum string, err error) {
 	err = nil
 	accNum = ""
@@ -41,59 +101,43 @@ func parseKubernetesNamespace(raw []byte) (respObj types.KubernetesNamespace, er
 	return
 }
 
-func doHTTPRequest(url, apiKey string) (raw []byte, err error) {
-	raw = nil
-	// Generated by curl-to-Go: https://mholt.github.io/curl-to-go
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		err := fmt.Errorf("failed to create request to url=%s err=%s", url, err.Error())
-		glog.Error(err)
-		return nil, err
+// doHTTPRequest fetches url with LookupClient, authenticating with apiKey when there is one
+func doHTTPRequest(ctx context.Context, url, apiKey string) (raw []byte, err error) {
+	header := http.Header{}
+	if apiKey != "" {
+		header.Set("X-Api-Key", apiKey)
 	}
-	req.Header.Set("X-Api-Key", apiKey)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode != 200 {
-		if resp == nil {
-			err = fmt.Errorf("request to url=%s failed err=%s", url, err.Error())
-		}
+	raw, err = LookupClient.Get(ctx, url, header)
+	if err != nil {
 		glog.Error(err)
 		return nil, err
 	}
-
-	raw, err = ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
 	return raw, nil
 }
 
-func runRawCurlCommands(url string) (raw []byte, err error) {
-	curlCmd := fmt.Sprintf("curl -s %s", url)
-	out, err := utils.RunBashCmd(curlCmd)
-
-	if err != nil {
-		err = fmt.Errorf("failed to successfully run [%s] err=%s", curlCmd, err.Error())
-		glog.Error(err)
-		raw = nil
-	}
-	raw = []byte(out)
-	return
-}
-
-func getAWSAccountOwnerID(baseURL, apiKey, awsAccNum string) (ownerID string, err error) {
+func getAWSAccountOwnerID(ctx context.Context, baseURL, apiKey, awsAccNum string) (ownerID string, err error) {
 	url := getAccountOwnerIDEndpoint(baseURL, awsAccNum)
 	ownerID = ""
 	err = nil
 
-	rBody, err := doHTTPRequest(url, apiKey)
-	respJSON, err := parseAccOwnerResponse(rBody)
+	rBody, err := doHTTPRequest(ctx, url, apiKey)
 	if err != nil {
 		err = fmt.Errorf("doHttpRequest to getAWSAccountOwnerID url=%s failed, err=%s", url, err.Error())
 		glog.Error(err)
-		ownerID = ""
-	} else {
-		err = nil
-		ownerID = fmt.Sprintf("%d", respJSON.Data[0].OwnerTeamID)
+		return
+	}
+	respJSON, err := parseAccOwnerResponse(rBody)
+	if err != nil {
+		err = fmt.Errorf("failed to parse response from end point %s, err=%s", url, err.Error())
+		glog.Error(err)
+		return
 	}
+	if len(respJSON.Data) == 0 {
+		err = fmt.Errorf("end point %s knows no owner of AWS account number=%s", url, awsAccNum)
+		glog.Error(err)
+		return
+	}
+	ownerID = fmt.Sprintf("%d", respJSON.Data[0].OwnerTeamID)
 	return
 }
 
@@ -102,10 +146,10 @@ func parseAdSecGrpResponse(raw []byte) (respObj types.AdSecurityGroupResp, err e
 	return
 }
 
-func getOwnerADSecurityGroup(baseURL, apiKey, ownerTeamID string) (adSecGrp string, err error) {
+func getOwnerADSecurityGroup(ctx context.Context, baseURL, apiKey, ownerTeamID string) (adSecGrp string, err error) {
 	url := fmt.Sprintf("%s/%s=%s", baseURL, types.ADSecurityGroupEndPoint, ownerTeamID)
 
-	rBody, err := doHTTPRequest(url, apiKey)
+	rBody, err := doHTTPRequest(ctx, url, apiKey)
 	if err != nil {
 		err = fmt.Errorf("doHttpRequest to url=%s failed, err=%s", url, err.Error())
 		glog.Error(err)
@@ -120,38 +164,17 @@ func getOwnerADSecurityGroup(baseURL, apiKey, ownerTeamID string) (adSecGrp stri
 		return
 	}
 
-	err = nil
-	adSecGrp = respJSON.Data[0].ADSecurityGroup
-	return
-}
-
-func parseADGroupMemberListResp(raw []byte) (respJSON types.ADGroupMemberListResp, err error) {
-	err = json.Unmarshal(raw, &respJSON)
-	return
-}
-
-func parseADUserResp(raw []byte) (respJSON types.ADUser, err error) {
-	err = json.Unmarshal(raw, &respJSON)
-	return
-}
-
-func getAdGrpMembers(adGroupLkpURL, adSecGrp string) (owners []string, err error) {
-	url := fmt.Sprintf("%s/%s", adGroupLkpURL, adSecGrp)
-
-	out, err := runRawCurlCommands(url)
-	if err != nil {
-		err = fmt.Errorf("failed to successfully run runRawCurlCommands(%s) err=%s", url, err.Error())
+	if len(respJSON.Data) == 0 {
+		err = fmt.Errorf("end point %s knows no AD security group of team=%s", url, ownerTeamID)
 		glog.Error(err)
-		owners = nil
 		return
 	}
-	adGrpMemberListResp, err := parseADGroupMemberListResp(out)
-	owners = adGrpMemberListResp.Members.Users
-	err = nil
+	adSecGrp = respJSON.Data[0].ADSecurityGroup
 	return
 }
 
-func getRoleOwners(adGrpListURL, mdsURL, mdsAPIKey, awsRoleArn string) (owners []string, err error) {
+// getRoleOwners returns the members of the AD security group of the team that owns the AWS account of awsRoleArn
+func (b *Bot) getRoleOwners(ctx context.Context, mdsURL, mdsAPIKey, awsRoleArn string) (owners []types.ADUser, err error) {
 	owners = nil
 	err = nil
 	awsAccountNumber, err := getAccNumFromRoleArn(awsRoleArn)
@@ -159,17 +182,17 @@ func getRoleOwners(adGrpListURL, mdsURL, mdsAPIKey, awsRoleArn string) (owners [
 		glog.Errorf("Failed to parse account number from role=[%s]\n", awsRoleArn)
 		return
 	}
-	roleAccOwnerID, err := getAWSAccountOwnerID(mdsURL, mdsAPIKey, awsAccountNumber)
+	roleAccOwnerID, err := b.lookupAccountOwnerID(ctx, mdsURL, mdsAPIKey, awsAccountNumber)
 	if err != nil {
 		glog.Errorf("Failed to get role owner ID for AWS account number=[%s]\n", awsAccountNumber)
 		return
 	}
-	adSecGrp, err := getOwnerADSecurityGroup(mdsURL, mdsAPIKey, roleAccOwnerID)
+	adSecGrp, err := b.lookupTeamADSecurityGroup(ctx, mdsURL, mdsAPIKey, roleAccOwnerID)
 	if err != nil {
 		glog.Errorf("Failed to translate ownerID=[%s] to AD security group.\n", roleAccOwnerID)
 		return
 	}
-	owners, err = getAdGrpMembers(adGrpListURL, adSecGrp)
+	owners, err = b.lookupGroupMembers(ctx, adSecGrp)
 	if err != nil {
 		owners = nil
 		glog.Errorf("Failed to get members of AD security group=[%s].\n", adSecGrp)
@@ -177,228 +200,386 @@ func getRoleOwners(adGrpListURL, mdsURL, mdsAPIKey, awsRoleArn string) (owners [
 	return
 }
 
-func getADUsrLookupEp(fName, lName, adLookupServerURL string) string {
-	const comma = `%2c`
-	const space = `%20`
-	return fmt.Sprintf("%s/%s%s%s%s", adLookupServerURL, lName, comma, space, fName)
+// getADUserForSlackUser returns the directory user who is the Slack user slackUID
+func (b *Bot) getADUserForSlackUser(ctx context.Context, slackUID string) (types.ADUser, error) {
+	return b.Lookups.users.Get(ctx, slackUID, func(ctx context.Context) (adUsr types.ADUser, err error) {
+		su, err := b.Responder.LookupUser(slackUID)
+		if err != nil {
+			glog.Error(err)
+			return
+		}
+		glog.V(1).Infof("SlackUser=%s\n", utils.StringifySlackUser(su))
+		adUsr, err = b.Identity.ResolveSlackUser(ctx, su)
+		glog.V(1).Infof("AD user=%s\n", utils.StringifyADUser(adUsr))
+		return
+	})
 }
 
-func getADUserByCN(fName, lName, email, adUsrLookupURL string) (usr types.ADUser, err error) {
-	url := getADUsrLookupEp(fName, lName, adUsrLookupURL)
-	out, err := runRawCurlCommands(url)
-	if err != nil {
-		err = fmt.Errorf("failed to successfully run [%s] err=%s", url, err.Error())
-		glog.Error(err)
-	} else {
-		usr, err = parseADUserResp(out)
-		if strings.ToLower(usr.Email) != strings.ToLower(email) {
-			errStr := fmt.Sprintf("AD user's Email=[%s] doesn't match Slack user=[%s]", usr.Email, email)
-			glog.Error(errStr)
-			err = fmt.Errorf(errStr)
+// isRequestorOwner reports whether adUsr is one of owners, matching them by email address, LanID or employee number
+func isRequestorOwner(adUsr types.ADUser, owners []types.ADUser) bool {
+	for _, owner := range owners {
+		if identity.SameUser(adUsr, owner) {
+			return true
 		}
 	}
-	return
+	return false
 }
 
-func getADUserForSlackUser(slackUID, adUsrLookupURL string) (adUsr types.ADUser, err error) {
-	su := slack.SlackUserMap[slackUID]
-	glog.V(1).Infof("SlackUser=%s\n", utils.StringifySlackUser(su))
-	adUsr, err = getADUserByCN(su.Profile.FirstName, su.Profile.LastName, su.Profile.Email, adUsrLookupURL)
-	glog.V(1).Infof("AD user=%s\n", utils.StringifyADUser(adUsr))
-	return
+// ownerNames returns the names owners are shown to users by
+func ownerNames(owners []types.ADUser) []string {
+	names := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		names = append(names, owner.Cn)
+	}
+	return names
 }
 
-func isRequestorOwner(adUsr types.ADUser, owners []string) bool {
-	matcherKey := fmt.Sprintf("%s, %s", adUsr.LastName, adUsr.FirstName)
-	res := false
-	// Do better than linear search? Hopefully this is a small slice
+// ownerEmails returns the emails of the owners that have one
+func ownerEmails(owners []types.ADUser) []string {
+	emails := make([]string, 0, len(owners))
 	for _, owner := range owners {
-		if strings.ToLower(owner) == strings.ToLower(matcherKey) {
-			res = true
-			break
+		if owner.Email != "" {
+			emails = append(emails, owner.Email)
 		}
 	}
-	return res
+	return emails
 }
 
 func isRequestValid(botReqParams types.BotReqParams) bool {
-	return botReqParams.ADGroupLookupURL != "" &&
-		botReqParams.ADUserLookupURL != "" &&
-		botReqParams.AWSAPIKey != "" &&
+	return botReqParams.AWSAPIKey != "" &&
 		botReqParams.AWSMetadataServerURL != "" &&
 		botReqParams.KubeConfig != "" &&
-		botReqParams.Message != "" &&
 		botReqParams.SlackUser != "" &&
-		len(strings.Split(botReqParams.Message, " ")) == types.Kube2IamBotReqLength
+		len(botReqParams.Fields) == types.Kube2IamBotReqLength
 }
 
 // RequestKube2IamReq validates kube2iam request
-func RequestKube2IamReq(botParams types.BotReqParams) string {
+func (b *Bot) RequestKube2IamReq(ctx context.Context, botParams types.BotReqParams) Response {
 
 	if !isRequestValid(botParams) {
-		return fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.RequestKube2IamBotReqFormat, botParams.Message)
+		return Response{Text: fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.RequestKube2IamBotReqFormat, botParams.Message)}
 	}
 
-	msgParts := strings.Split(botParams.Message, " ")
-	var resp string
-
-	namespace := msgParts[2]
-	awsRoleArn := msgParts[3]
-	cluster := msgParts[4]
+	namespace := botParams.Fields[2]
+	awsRoleArn := botParams.Fields[3]
+	cluster := botParams.Fields[4]
+	if err := b.validateKube2IamTarget(namespace, awsRoleArn, cluster); err != nil {
+		return invalidRequest(err)
+	}
+	outcome := kube2iamOutcome{Title: "kube2iam request failed", Namespace: namespace, RoleArn: awsRoleArn, Cluster: cluster}
 
-	owners, err := getRoleOwners(botParams.ADGroupLookupURL, botParams.AWSMetadataServerURL, botParams.AWSAPIKey, awsRoleArn)
+	owners, err := b.getRoleOwners(ctx, botParams.AWSMetadataServerURL, botParams.AWSAPIKey, awsRoleArn)
 	if err != nil {
-		errStr := fmt.Sprintf("Failed to get owners of awsRoleArn=%s. err=%s", awsRoleArn, err.Error())
+		errStr := b.failure(ctx, "looking up the owners of "+awsRoleArn, fmt.Sprintf("Failed to get owners of awsRoleArn=%s. err=%s", awsRoleArn, err.Error()))
 		glog.Error(errStr)
-		return errStr
+		outcome.Result = errStr
+		return outcome.response(errStr)
 	}
+	outcome.Owners = ownerNames(owners)
 
-	adUsr, err := getADUserForSlackUser(botParams.SlackUser, botParams.ADUserLookupURL)
+	// requesters who can't be resolved may still ask the owners, they just can't approve their own requests
+	adUsr, err := b.getADUserForSlackUser(ctx, botParams.SlackUser)
 	if err != nil {
 		glog.Errorf("Unable to get AD user for <@%s> for authorization", botParams.SlackUser)
+		if timedOut(ctx) {
+			outcome.Result = b.failure(ctx, "looking up your AD user", err.Error())
+			return outcome.response(outcome.Result)
+		}
 	}
 
-	if isRequestorOwner(adUsr, owners) {
-		resp = ApproveKube2IamReq(botParams)
-	} else {
-		approveMsg := fmt.Sprintf("```%s %s %s %s```", types.ApproveKube2IamBotReq, namespace, awsRoleArn, cluster)
-		resp = fmt.Sprintf("Hi <@%s>,\nOwners of ARN [%s] are\n %s.\n Please have one of the owners copy paste\n %s",
-			botParams.SlackUser, awsRoleArn, strings.Join(owners, "\n"), approveMsg)
+	if err == nil && isRequestorOwner(adUsr, owners) {
+		resp, _ := b.allowKube2IamRole(ctx, botParams, outcome)
+		return resp
 	}
-	return resp
-}
 
-func addNewKube2IamRole(currentAllowedRoles, newRole string) string {
-	var newRoleSet string
-	currentAllowedRoles = strings.Trim(currentAllowedRoles, "\n")
-	glog.V(1).Infof("%s %t", currentAllowedRoles, currentAllowedRoles == "[]")
-	if currentAllowedRoles == "[]" {
-		newRoleSet = fmt.Sprintf("[\"%s\"]", newRole)
-	} else {
-		currentAllowedRoles = strings.Trim(currentAllowedRoles, "[")
-		currentAllowedRoles = strings.Trim(currentAllowedRoles, "]")
-		newRoleSet = "["
-		roleAlreadyExists := false
-		for _, role := range strings.Split(currentAllowedRoles, ",") {
-			glog.V(1).Infof("kube2IamRole=%s", role)
-			newRoleSet += fmt.Sprintf("%s,", role)
-
-			if role == "\""+newRole+"\"" {
-				roleAlreadyExists = true
-			}
-		}
-		if !roleAlreadyExists {
-			newRoleSet += fmt.Sprintf("\"%s\"", newRole)
-		} else {
-			glog.V(6).Infof("Role %s exists in %s", newRole, currentAllowedRoles)
-		}
-		newRoleSet = strings.Trim(newRoleSet, ",")
-		newRoleSet += "]"
+	req, err := b.Store.Add(types.Kube2IamRequest{
+		Requester:   botParams.SlackUser,
+		Namespace:   namespace,
+		RoleArn:     awsRoleArn,
+		Cluster:     cluster,
+		Owners:      outcome.Owners,
+		OwnerEmails: ownerEmails(owners),
+	})
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to record kube2iam request for awsRoleArn=%s to namespace=%s. err=%s", awsRoleArn, namespace, err.Error())
+		glog.Error(errStr)
+		outcome.Result = errStr
+		return outcome.response(errStr)
 	}
+	glog.V(1).Infof("Recorded kube2iam request %s\n", utils.StringifyKube2IamRequest(req))
+
+	approveMsg := fmt.Sprintf("```%s %s```", types.ApproveKube2IamBotReq, req.ID)
+	resp := fmt.Sprintf("Hi <@%s>,\nOwners of ARN [%s] are\n %s.\n Please have one of the owners copy paste\n %s",
+		botParams.SlackUser, awsRoleArn, strings.Join(outcome.Owners, "\n"), approveMsg)
+	outcome = getKube2IamOutcome(req)
+	outcome.Title = "kube2iam request pending approval"
+	outcome.Result = fmt.Sprintf("Hi <@%s>, please have one of the owners approve or deny this request, or copy paste\n%s", botParams.SlackUser, approveMsg)
+	outcome.Actions = kube2iamRequestButtons(req.ID)
+	return outcome.response(resp)
+}
 
+// addNewKube2IamRole adds newRole to the allowed roles annotation value currentAllowedRoles
+func addNewKube2IamRole(currentAllowedRoles, newRole string) (newRoleSet string, err error) {
+	roles, err := kube2iam.ParseAllowedRoles(currentAllowedRoles)
+	if err != nil {
+		return
+	}
+	if !roles.Add(newRole) {
+		glog.V(6).Infof("Role %s exists in %s", newRole, currentAllowedRoles)
+	}
+	newRoleSet = roles.String()
 	glog.V(8).Infof("newRoleSet=%s\n", newRoleSet)
-	return newRoleSet
+	return
+}
+
+func isApprovalValid(botReqParams types.BotReqParams) bool {
+	return botReqParams.AWSMetadataServerURL != "" &&
+		botReqParams.KubeConfig != "" &&
+		botReqParams.SlackUser != "" &&
+		len(botReqParams.Fields) == types.ApproveKube2IamBotReqLength
 }
 
-// ApproveKube2IamReq applies kube2iam annotations to namespaces
-func ApproveKube2IamReq(botReqParams types.BotReqParams) string {
-	if !isRequestValid(botReqParams) {
-		return fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.ApproveKube2IamBotReqFormat, botReqParams.Message)
+// ApproveKube2IamReq applies the pending kube2iam request referenced by its ID to the namespace
+func (b *Bot) ApproveKube2IamReq(ctx context.Context, botReqParams types.BotReqParams) Response {
+	if !isApprovalValid(botReqParams) {
+		return Response{Text: fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.ApproveKube2IamBotReqFormat, botReqParams.Message)}
 	}
 
 	glog.V(1).Infof("Received request %s\n", utils.StringifyBotReqParams(botReqParams))
 
-	msgTxtArr := strings.Split(botReqParams.Message, " ")
-	var resp string
-	namespace := msgTxtArr[2]
-	awsRoleArn := msgTxtArr[3]
-	cluster := msgTxtArr[4]
+	reqID := botReqParams.Fields[2]
+	resp, _ := b.decideKube2IamReq(ctx, botReqParams, reqID, true)
+	return resp
+}
 
-	roleOwners, err := getRoleOwners(botReqParams.ADGroupLookupURL, botReqParams.AWSMetadataServerURL, botReqParams.AWSAPIKey, awsRoleArn)
-	if err != nil {
-		resp = fmt.Sprintf("Failed to get owners of awsRoleArn=%s. err=%s", awsRoleArn, err.Error())
+// decideKube2IamReq approves or denies the pending request reqID on behalf of the user making botReqParams.
+// The request stays pending unless the decision was carried out.
+func (b *Bot) decideKube2IamReq(ctx context.Context, botReqParams types.BotReqParams, reqID string, approve bool) (Response, bool) {
+	req, err := b.Store.Get(reqID)
+	if err == store.ErrRequestNotFound {
+		resp := fmt.Sprintf("There is no pending kube2iam request with ID %s", reqID)
+		return Response{Text: resp}, false
+	} else if err != nil {
+		resp := fmt.Sprintf("Failed to look up kube2iam request %s. err=%s", reqID, err.Error())
 		glog.Errorf(resp)
-		return resp
+		return Response{Text: resp}, false
 	}
-	adUsr, err := getADUserForSlackUser(botReqParams.SlackUser, botReqParams.ADUserLookupURL)
-	if err != nil {
-		glog.Errorf("Unable to get AD user for <@%s> for authorization", botReqParams.SlackUser)
+
+	if b.isExpired(req, time.Now()) {
+		return b.expiredResponse(reqID), false
 	}
 
-	if !isRequestorOwner(adUsr, roleOwners) {
-		resp = fmt.Sprintf("User <@%s> is not allowed to approve kube2Iam requests for role %s to namespace %s", botReqParams.SlackUser, awsRoleArn, namespace)
+	outcome := getKube2IamOutcome(req)
+	if resp, ok := b.authorizeRoleOwner(ctx, botReqParams, &outcome); !ok {
+		return resp, false
+	}
+
+	// claim the request so that concurrent decisions and the expiry of the request can't both act on it
+	if req, err = b.Store.Take(reqID); err == store.ErrRequestNotFound {
+		resp := fmt.Sprintf("kube2iam request %s was already decided", reqID)
+		return Response{Text: resp}, false
+	} else if err != nil {
+		resp := fmt.Sprintf("Failed to claim kube2iam request %s. err=%s", reqID, err.Error())
 		glog.Errorf(resp)
-		return resp
+		return Response{Text: resp}, false
+	}
+	// the request may have expired while its owners were looked up, leave it for checkPendingRequests to expire
+	if b.isExpired(req, time.Now()) {
+		if err = b.Store.Restore(req); err != nil {
+			glog.Errorf("Failed to keep expired kube2iam request %s for expiry. err=%s\n", req.ID, err.Error())
+		}
+		return b.expiredResponse(reqID), false
+	}
+
+	if !approve {
+		outcome.Title = "kube2iam request denied"
+		outcome.Result = fmt.Sprintf("<@%s> denied the request.", botReqParams.SlackUser)
+		return outcome.response(fmt.Sprintf("User <@%s> denied kube2Iam request %s for role %s to namespace %s", botReqParams.SlackUser, req.ID, req.RoleArn, req.Namespace)), true
+	}
+	resp, ok := b.allowKube2IamRole(ctx, botReqParams, outcome)
+	if !ok {
+		if err = b.Store.Restore(req); err != nil {
+			glog.Errorf("Failed to keep kube2iam request %s pending after its approval failed. err=%s\n", req.ID, err.Error())
+		}
+	}
+	return resp, ok
+}
+
+// expiredResponse tells the user deciding the request reqID that it expired
+func (b *Bot) expiredResponse(reqID string) Response {
+	return Response{Text: fmt.Sprintf("kube2iam request %s expired after %s without being approved", reqID, b.RequestTTL)}
+}
+
+// getKube2IamOutcome returns the outcome of deciding the pending request req
+func getKube2IamOutcome(req types.Kube2IamRequest) kube2iamOutcome {
+	return kube2iamOutcome{
+		Title:     "kube2iam approval failed",
+		RequestID: req.ID,
+		Requester: req.Requester,
+		Namespace: req.Namespace,
+		RoleArn:   req.RoleArn,
+		Cluster:   req.Cluster,
+		Owners:    req.Owners,
 	}
+}
 
-	nsJSON, err := utils.GetNamespaceDefnJSON(botReqParams.KubeConfig, cluster, namespace)
+// authorizeRoleOwner checks that the user making the request owns the role ARN of outcome.
+// When they don't, the returned Response explains why.
+func (b *Bot) authorizeRoleOwner(ctx context.Context, botReqParams types.BotReqParams, outcome *kube2iamOutcome) (Response, bool) {
+	var resp string
+	roleOwners, err := b.getRoleOwners(ctx, botReqParams.AWSMetadataServerURL, botReqParams.AWSAPIKey, outcome.RoleArn)
 	if err != nil {
-		resp = fmt.Sprintf("Failed to get namespace definition for namepsace=%s in cluster=%s. err=%s", namespace, cluster, err.Error())
+		resp = b.failure(ctx, "looking up the owners of "+outcome.RoleArn, fmt.Sprintf("Failed to get owners of awsRoleArn=%s. err=%s", outcome.RoleArn, err.Error()))
 		glog.Errorf(resp)
-		return resp
+		outcome.Result = resp
+		return outcome.response(resp), false
 	}
-	nsObj, err := parseKubernetesNamespace([]byte(nsJSON))
+	outcome.Owners = ownerNames(roleOwners)
+	adUsr, err := b.getADUserForSlackUser(ctx, botReqParams.SlackUser)
 	if err != nil {
-		resp = fmt.Sprintf("failed to parse namespace definition for namespace=%s, %s", namespace, err.Error())
+		resp = b.failure(ctx, "looking up your AD user", fmt.Sprintf("Unable to find the AD user of <@%s> to check they own role %s. err=%s", botReqParams.SlackUser, outcome.RoleArn, err.Error()))
 		glog.Errorf(resp)
-		return resp
+		outcome.Title, outcome.Result = "kube2iam approval denied", resp
+		return outcome.response(resp), false
 	}
 
-	nsObj.Metadata.Annotations.Kube2IamAllowedRoles = addNewKube2IamRole(nsObj.Metadata.Annotations.Kube2IamAllowedRoles, awsRoleArn)
-	var marshalled []byte
-	marshalled, err = json.Marshal(nsObj)
-	if err != nil {
-		resp = fmt.Sprintf("failed to marshall updated namespace metadata, err=%s", err.Error())
+	if !isRequestorOwner(adUsr, roleOwners) {
+		resp = fmt.Sprintf("User <@%s> is not allowed to approve kube2Iam requests for role %s to namespace %s", botReqParams.SlackUser, outcome.RoleArn, outcome.Namespace)
 		glog.Errorf(resp)
-		return resp
+		outcome.Title, outcome.Result = "kube2iam approval denied", resp
+		return outcome.response(resp), false
 	}
-	err = utils.UpdateNamespaceDefn(botReqParams.KubeConfig, cluster, nsObj.Metadata.Name, string(marshalled))
+	return Response{}, true
+}
+
+// allowKube2IamRole adds the role ARN of outcome to the allowed roles of its namespace, reporting whether it succeeded
+func (b *Bot) allowKube2IamRole(ctx context.Context, botReqParams types.BotReqParams, outcome kube2iamOutcome) (Response, bool) {
+	var resp string
+	namespace, awsRoleArn, cluster := outcome.Namespace, outcome.RoleArn, outcome.Cluster
+	newRoleSet, err := b.updateKube2IamAllowedRoles(ctx, cluster, namespace, func(allowedRoles string) (string, error) {
+		newRoleSet, err := addNewKube2IamRole(allowedRoles, awsRoleArn)
+		if err != nil {
+			return "", fmt.Errorf("failed to add role to namespace=%s, %s", namespace, err.Error())
+		}
+		return newRoleSet, nil
+	})
 	if err != nil {
-		resp = fmt.Sprintf("failed to update namespace metadata for namespace=%s in cluster=%s", namespace, cluster)
-		return resp
+		resp = b.failure(ctx, fmt.Sprintf("updating namespace %s in cluster %s", namespace, cluster), err.Error())
+		glog.Errorf(resp)
+		outcome.Result = resp
+		return outcome.response(resp), false
 	}
-	resp = fmt.Sprintf("Successsfully updated allowed roles on namespace=%s.\nAllowedRoles=[%s]", namespace, nsObj.Metadata.Annotations.Kube2IamAllowedRoles)
+	resp = fmt.Sprintf("Successsfully updated allowed roles on namespace=%s.\nAllowedRoles=[%s]", namespace, newRoleSet)
+	outcome.Title = "kube2iam role approved"
+	outcome.Result = fmt.Sprintf("<@%s> approved the role.\nAllowedRoles=[%s]", botReqParams.SlackUser, newRoleSet)
+
+	// the outcome matters to the whole channel, not just the thread the request was made in
+	approved := outcome.response(resp)
+	approved.Broadcast = true
+	return approved, true
+}
 
-	return resp
+// Response represents a bot handler's answer to a request
+type Response struct {
+	// Text is the whole answer when Blocks is empty, and the notification and fallback text otherwise
+	Text   string
+	Blocks []types.Block
+	// Broadcast also sends the threaded reply to the channel the request was made in
+	Broadcast bool
 }
 
+// getRespMsg returns a reply to req, threaded under req or in the thread req was posted to
 func getRespMsg(req types.Message) types.Message {
+	threadTs := req.ThreadTs
+	if threadTs == "" {
+		threadTs = req.Ts
+	}
 	return types.Message{
-		ID:      req.ID,
-		Channel: req.Channel,
-		Type:    req.Type,
-		User:    req.User,
+		ID:       req.ID,
+		Channel:  req.Channel,
+		Type:     req.Type,
+		User:     req.User,
+		ThreadTs: threadTs,
 	}
 }
 
 func getSupportedRequestTypes() string {
 	return "This Bot can help you with the following requests:\n" +
-		fmt.Sprintf("%s\n%s\n", types.RequestKube2IamBotReqFormat, types.ApproveKube2IamBotReqFormat)
+		fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s\n", types.RequestKube2IamBotReqFormat, types.ApproveKube2IamBotReqFormat, types.RevokeKube2IamBotReqFormat,
+			types.ListKube2IamBotReqFormat, types.WhoCanAssumeBotReqFormat, types.ListKube2IamReqsBotReqFormat)
 }
 
-// ProcessBotRquest processes the request based on the request type
-func ProcessBotRquest(slackConn *slack.ServerConn, req types.Message, adGroupLookupURL, metadataServerURL, metadataServerAPIKey, kubeconfig, adUsrLookupURL string) {
+// ProcessBotRquest processes the request based on the request type, giving up on it after RequestTimeout
+func (b *Bot) ProcessBotRquest(req types.Message) {
+	ctx, cancel := b.requestContext()
+	defer cancel()
+
 	reqText := req.Text
 	glog.V(2).Infof("Received request: %s\n", utils.StringifyMessage(req))
 
-	botReqType := utils.GetBotReqType(reqText)
-
-	botReqParams := utils.GetBotReqParams(adGroupLookupURL, adUsrLookupURL, metadataServerURL, metadataServerAPIKey, kubeconfig, reqText, req.User)
+	botReqParams := utils.GetBotReqParams(b.ADGroupLookupURL, b.ADUserLookupURL, b.AWSMetadataServerURL, b.AWSAPIKey, b.KubeConfig, reqText, req.User)
 	glog.V(6).Infof("%s\n", utils.StringifyBotReqParams(botReqParams))
 
-	var respText string
+	botReqType := utils.GetBotReqType(botReqParams.Fields)
+
+	var botResp Response
 	if botReqType == types.RequestKube2IamBotReq {
-		respText = RequestKube2IamReq(botReqParams)
+		botResp = b.RequestKube2IamReq(ctx, botReqParams)
 	} else if botReqType == types.ApproveKube2IamBotReq {
-		respText = ApproveKube2IamReq(botReqParams)
-	} else if botReqType == types.HelpBotReq {
-		respText = getSupportedRequestTypes()
+		botResp = b.ApproveKube2IamReq(ctx, botReqParams)
+	} else if botReqType == types.RevokeKube2IamBotReq {
+		botResp = b.RevokeKube2IamReq(ctx, botReqParams)
+	} else if botReqType == types.ListKube2IamBotReq {
+		botResp = b.ListKube2IamReq(ctx, botReqParams)
+	} else if botReqType == types.WhoCanAssumeBotReq {
+		botResp = b.WhoCanAssumeReq(ctx, botReqParams)
+	} else if botReqType == types.ListKube2IamReqsBotReq {
+		botResp = b.ListKube2IamReqs(botReqParams)
+	} else if botReqType == types.FlushCacheBotReq {
+		botResp = b.FlushCacheReq(botReqParams)
+	} else if botReqType == types.HelpBotReq || botReqType == "" {
+		botResp.Text = getSupportedRequestTypes()
 	} else {
-		respText = fmt.Sprintf("Unknown request type [%s]\n", botReqType) + getSupportedRequestTypes()
+		botResp.Text = fmt.Sprintf("Unknown request type [%s]\n", botReqType) + getSupportedRequestTypes()
 	}
 
 	resp := getRespMsg(req)
-	resp.Text = respText
+	resp.Text = botResp.Text
+	resp.Blocks = botResp.Blocks
+	resp.ReplyBroadcast = botResp.Broadcast && resp.ThreadTs != ""
+
+	if err := b.Responder.SendMessage(resp); err != nil {
+		glog.Errorf("Failed to send response %s. err=%s\n", utils.StringifyMessage(resp), err.Error())
+	}
+}
+
+// Run reads requests addressed to the bot from t and processes each of them concurrently until t is closed
+func (b *Bot) Run(t slack.Transport) error {
+	botUserID := t.BotUserID()
+	b.botUserID = botUserID
+	done := make(chan struct{})
+	defer close(done)
+	if it, ok := t.(slack.Interactive); ok {
+		go b.processInteractions(it.Interactions(), done)
+	}
+	if b.Store != nil {
+		go b.watchPendingRequests(done)
+	}
+	glog.V(1).Infoln("Slackbot listening for messages to process...")
+	for {
+		msg, err := t.ReadMessage()
+		if err == slack.ErrConnClosed {
+			return err
+		}
+		if err != nil {
+			glog.Errorf("Failed to read message sent to slackbot. err=%s\n", err.Error())
+			continue
+		}
+		if msg.Type != types.MessageType || !strings.HasPrefix(msg.Text, "<@"+botUserID+">") {
+			glog.V(9).Infof("Ignoring message %s\n", utils.StringifyMessage(msg))
+			continue
+		}
 
-	slackConn.SendMessage(resp)
+		go b.ProcessBotRquest(msg)
+	}
 }
@@ -1,15 +1,66 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/ashish-amarnath/slackbots/pkg/identity"
+	"github.com/ashish-amarnath/slackbots/pkg/k8s"
+	"github.com/ashish-amarnath/slackbots/pkg/k8stest"
+	"github.com/ashish-amarnath/slackbots/pkg/kube2iam"
+	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/store"
 	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/ashish-amarnath/slackbots/pkg/utils"
 	"github.com/golang/glog"
 	. "github.com/smartystreets/goconvey/convey"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+func newTestBot() *Bot {
+	bot := NewBot(slack.NewFakeTransport("UBOT"), nil, "", "", "", "", "")
+	bot.Kube = k8stest.NewClient(map[string][]*corev1.Namespace{"hydrogen": nil})
+	return bot
+}
+
+// setMessage sets the request message of params to msg, split into its words like GetBotReqParams does
+func setMessage(params *types.BotReqParams, msg string) {
+	params.Message = msg
+	params.Fields = strings.Fields(msg)
+}
+
+// newTestKube returns a fake kubernetes client whose hydrogen cluster has the namespace foo, owned by team 42
+func newTestKube(allowedRoles string) *k8s.Client {
+	return k8stest.NewClient(map[string][]*corev1.Namespace{
+		"hydrogen": {{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "foo",
+				Labels: map[string]string{"team": "blue"},
+				Annotations: map[string]string{
+					"cloud-team-id":                 "42",
+					"slack-channel-users":           "#foo",
+					kube2iam.AllowedRolesAnnotation: allowedRoles,
+				},
+			},
+		}},
+	})
+}
+
+func newTestStore(t *testing.T) store.RequestStore {
+	s, err := store.NewBoltStore(filepath.Join(t.TempDir(), "requests.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
 func TestGetAccNumFromRoleArn(t *testing.T) {
 	Convey("getAccNumFromRoleArn", t, func() {
 		Convey("should parse out account number from a valid AWS role ARN", func() {
@@ -125,25 +176,33 @@ func TestDoHTTPRequest(t *testing.T) {
 	Convey("doHTTPRequest should returh with error when unable to successfully process the HTTP request", t, func() {
 		url := "foobar.baz"
 		apiKey := "supersecret"
-		actual, err := doHTTPRequest(url, apiKey)
+		actual, err := doHTTPRequest(context.Background(), url, apiKey)
 		So(actual, ShouldBeNil)
 		So(err, ShouldNotBeNil)
 	})
 }
 
-func TestRunRawCurlCommands(t *testing.T) {
-	Convey("runRawCurlCommands should return with error when unable to successfully run the curl cmd", t, func() {
-		url := "foobar.baz"
-		atcual, err := runRawCurlCommands(url)
-		So(atcual, ShouldBeEmpty)
+func TestGetAWSAccountOwnerID(t *testing.T) {
+	Convey("getAWSAccountOwnerID should return error when unable to process request sucessfully", t, func() {
+		glog.Errorf("Expected Error:\n")
+		actual, err := getAWSAccountOwnerID(context.Background(), "https://example.com", "open-key", "123456789012")
+		So(actual, ShouldBeEmpty)
 		So(err, ShouldNotBeNil)
 	})
 }
 
-func TestGetAWSAccountOwnerID(t *testing.T) {
-	Convey("getAWSAccountOwnerID should return error when unable to process request sucessfully", t, func() {
-		glog.Errorf("Expected Error:\n")
-		actual, err := getAWSAccountOwnerID("https://example.com", "open-key", "123456789012")
+// newEmptyMetadataServer answers every metadata server request with no data
+func newEmptyMetadataServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[]}`))
+	}))
+}
+
+func TestGetAWSAccountOwnerIDWithoutData(t *testing.T) {
+	Convey("getAWSAccountOwnerID should return error when the metadata server knows no owner of the account", t, func() {
+		srv := newEmptyMetadataServer()
+		defer srv.Close()
+		actual, err := getAWSAccountOwnerID(context.Background(), srv.URL, "open-key", "123456789012")
 		So(actual, ShouldBeEmpty)
 		So(err, ShouldNotBeNil)
 	})
@@ -176,61 +235,18 @@ func TestGetOwnerADSecurityGroup(t *testing.T) {
 		url := "foobar.baz"
 		apiKey := "supersecret"
 		owner := "ADMINS"
-		actual, err := getOwnerADSecurityGroup(url, apiKey, owner)
+		actual, err := getOwnerADSecurityGroup(context.Background(), url, apiKey, owner)
 		So(actual, ShouldBeEmpty)
 		So(err, ShouldNotBeNil)
 	})
 }
 
-func TestParseADGroupMemberListResp(t *testing.T) {
-	Convey("parseADGroupMemberListResp", t, func() {
-		Convey("Should fail when called with invalid JSON bytes", func() {
-			invalidJSON := `{"name":"codeNinjas","description":"super awesome group","email":"codeninjas`
-			_, err := parseADGroupMemberListResp([]byte(invalidJSON))
-			So(err, ShouldNotBeNil)
-		})
-		Convey("Should parse a valid JSON string into ADGroupMemberListResp", func() {
-			validJSON := `{"name":"codeNinjas","description":"super awesome group","email":"codeninjas@ninjaing.com","type":"unittest","updated":"2017-08-28T17:24:46.000Z","members":{"groups":[],"users":["ninja1","ninja2","ninja3","ninja4","ninja5"]},"managedBy":{"group":null,"user":"ninjaLeader"},"groups":["Ninja-Team1","Ninja-Team2","Ninja-Team3"]}`
-			actual, err := parseADGroupMemberListResp([]byte(validJSON))
-			So(err, ShouldBeNil)
-			So(actual.Description, ShouldResemble, "super awesome group")
-			So(actual.Name, ShouldResemble, "codeNinjas")
-			So(actual.Email, ShouldResemble, "codeninjas@ninjaing.com")
-			So(actual.Type, ShouldResemble, "unittest")
-			So(strings.Join(actual.Members.Users, ","), ShouldResemble, "ninja1,ninja2,ninja3,ninja4,ninja5")
-		})
-	})
-}
-
-func TestParseADUserResp(t *testing.T) {
-	Convey("parseADUserResp", t, func() {
-		Convey("should parse a valid JSON string to ADUser", func() {
-			validJSON := `{"cn":"Doe, John","lanID":"XYZ7","firstName":"John","lastName":"Doe","email":"John.Doe@johndoe.com","manager":"Q, Madam","employeeNumber":"007"}`
-
-			actual, err := parseADUserResp([]byte(validJSON))
-			So(err, ShouldBeNil)
-			So(actual.Cn, ShouldResemble, "Doe, John")
-			So(actual.LanID, ShouldResemble, "XYZ7")
-			So(actual.FirstName, ShouldResemble, "John")
-			So(actual.LastName, ShouldResemble, "Doe")
-			So(actual.Email, ShouldResemble, "John.Doe@johndoe.com")
-			So(actual.Manager, ShouldResemble, "Q, Madam")
-			So(actual.EmployeeNumber, ShouldResemble, "007")
-		})
-		Convey("should fail when called with invalid JSON string", func() {
-			invalidJSON := `{"cn":"Doe, John","lanID":"XYZ7","firstName":"John","lastName":"Doe","email":"John.Doe@jo`
-			_, err := parseADUserResp([]byte(invalidJSON))
-			So(err, ShouldNotBeNil)
-		})
-	})
-}
-
-func TestGetAdGrpMembers(t *testing.T) {
-	Convey("getAdGrpMembers should return with error when unable to get members of an AD group", t, func() {
-		url := "myadserver.foo"
-		adGrp := "ADMINS"
-		actual, err := getAdGrpMembers(url, adGrp)
-		So(actual, ShouldBeNil)
+func TestGetOwnerADSecurityGroupWithoutData(t *testing.T) {
+	Convey("getOwnerADSecurityGroup should return error when the metadata server knows no AD security group of the team", t, func() {
+		srv := newEmptyMetadataServer()
+		defer srv.Close()
+		actual, err := getOwnerADSecurityGroup(context.Background(), srv.URL, "supersecret", "42")
+		So(actual, ShouldBeEmpty)
 		So(err, ShouldNotBeNil)
 	})
 }
@@ -242,7 +258,8 @@ func TestGetRoleOwners(t *testing.T) {
 			msdURL := "super-awesome-mdsSrv.foo"
 			mdsAPIKey := "topsecret"
 			testRole := "arn:aws:iam::123456789012:role/superawesome-powerful-Role3"
-			actual, err := getRoleOwners(adGrpURL, msdURL, mdsAPIKey, testRole)
+			bot := NewBot(slack.NewFakeTransport("UBOT"), nil, adGrpURL, msdURL, mdsAPIKey, "", "")
+			actual, err := bot.getRoleOwners(context.Background(), msdURL, mdsAPIKey, testRole)
 			So(actual, ShouldBeNil)
 			So(err, ShouldNotBeNil)
 		})
@@ -251,70 +268,44 @@ func TestGetRoleOwners(t *testing.T) {
 			msdURL := "super-awesome-mdsSrv.foo"
 			mdsAPIKey := "topsecret"
 			testRole := "arn-aws-iam--123456789012-role/superawesome-powerful-Role3"
-			actual, err := getRoleOwners(adGrpURL, msdURL, mdsAPIKey, testRole)
+			bot := NewBot(slack.NewFakeTransport("UBOT"), nil, adGrpURL, msdURL, mdsAPIKey, "", "")
+			actual, err := bot.getRoleOwners(context.Background(), msdURL, mdsAPIKey, testRole)
 			So(actual, ShouldBeNil)
 			So(err, ShouldNotBeNil)
 		})
 	})
 }
 
-func TestGetADUsrLookupEp(t *testing.T) {
-	Convey("getADUsrLookupEp should return the correct AD user lookup endpoint", t, func() {
-		expected := `https://adUsrLkp/api/v1/usr/get/doe%2c%20john`
-		actual := getADUsrLookupEp("john", "doe", "https://adUsrLkp/api/v1/usr/get")
-		So(actual, ShouldResemble, expected)
-	})
-}
-
-func TestGetADUserByCN(t *testing.T) {
-	Convey("getADUserByCN should return with error when unable to get the requested AD user", t, func() {
-		fname := "John"
-		lname := "Doe"
-		email := "john.doe@johndoe.com"
-		adUsrURL := "https://adUsrLkp/api/v1/usr/get"
-		_, err := getADUserByCN(fname, lname, email, adUsrURL)
-		So(err, ShouldNotBeNil)
-	})
-}
-
 func TestGetADUserForSlackUser(t *testing.T) {
 	Convey("getADUserForSlackUser return error when unable to get AD user corresponding to the supplied slack user", t, func() {
 		testSlackUsr := "U725Q5UAY"
 		adUsrURL := "https://adUsrLkp/api/v1/usr/get"
-		_, err := getADUserForSlackUser(testSlackUsr, adUsrURL)
+		bot := NewBot(slack.NewFakeTransport("UBOT"), nil, "", "", "", "", adUsrURL)
+		_, err := bot.getADUserForSlackUser(context.Background(), testSlackUsr)
 		So(err, ShouldNotBeNil)
 	})
 }
 
 func TestIsRequestorOwner(t *testing.T) {
 	Convey("isRequestorOwner", t, func() {
-		Convey("should return true when requestor is owner", func() {
-			var testADUsr types.ADUser
-			testADUsr.FirstName = "jOhN"
-			testADUsr.LastName = "dOe"
-			testADUsr.Email = "JOHN.DOE@jOhnDoE.cOm"
-			var owners []string
-
-			owners = append(owners, "Foe, John")
-			owners = append(owners, "bar, foo")
-			owners = append(owners, "Doe, Jane")
-			owners = append(owners, "DoE, JoHn")
-			actual := isRequestorOwner(testADUsr, owners)
-			So(actual, ShouldBeTrue)
+		owners := []types.ADUser{
+			{Cn: "Foe, John", LanID: "FOE1", Email: "john.foe@johndoe.com"},
+			{Cn: "Doe, John", LanID: "XYZ7", Email: "John.Doe@johndoe.com", EmployeeNumber: "007"},
+		}
+		Convey("should return true when the requestor has the identifiers of an owner", func() {
+			So(isRequestorOwner(types.ADUser{FirstName: "Johnny", LastName: "D", Email: "JOHN.DOE@jOhnDoE.cOm"}, owners), ShouldBeTrue)
+			So(isRequestorOwner(types.ADUser{LanID: "xyz7"}, owners), ShouldBeTrue)
+			So(isRequestorOwner(types.ADUser{EmployeeNumber: "007", Email: "john.doe@johndoe.com"}, owners), ShouldBeTrue)
 		})
-		Convey("should return false when requestor is not owner", func() {
-			var testADUsr types.ADUser
-			testADUsr.FirstName = "jOhN"
-			testADUsr.LastName = "dOe"
-			testADUsr.Email = "JOHN.DOE@jOhnDoE.cOm"
-			var owners []string
-
-			owners = append(owners, "Foe, John")
-			owners = append(owners, "bar, foo")
-			owners = append(owners, "Doe, Jane")
-			owners = append(owners, "DoE, James")
-			actual := isRequestorOwner(testADUsr, owners)
-			So(actual, ShouldBeFalse)
+		Convey("should return false for a requestor who only shares the name of an owner", func() {
+			So(isRequestorOwner(types.ADUser{Cn: "Doe, John", FirstName: "John", LastName: "Doe", Email: "john.doe2@johndoe.com", LanID: "XYZ8"}, owners), ShouldBeFalse)
+		})
+		Convey("should return false when an identifier of the requestor differs from the owner's", func() {
+			So(isRequestorOwner(types.ADUser{Email: "john.doe@johndoe.com", EmployeeNumber: "008"}, owners), ShouldBeFalse)
+		})
+		Convey("should return false for a requestor without identifiers", func() {
+			So(isRequestorOwner(types.ADUser{}, owners), ShouldBeFalse)
+			So(isRequestorOwner(types.ADUser{}, []types.ADUser{{Cn: "Nobody, Known"}}), ShouldBeFalse)
 		})
 	})
 }
@@ -328,12 +319,22 @@ func TestIsRequestValid(t *testing.T) {
 			validReq.AWSAPIKey = "blahziblahziblah"
 			validReq.AWSMetadataServerURL = "https://jibberish.execute-api.us-west-81.amazonaws.com"
 			validReq.KubeConfig = "/User/craycrayuser/.kube/config"
-			validReq.Message = "@superbot !doSomethingAwesome foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen"
+			setMessage(&validReq, "@superbot !doSomethingAwesome foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen")
 			validReq.SlackUser = "UCRAY7Q"
 
 			actual := isRequestValid(validReq)
 			So(actual, ShouldBeTrue)
 		})
+		Convey("should return true for a valid request with extra spaces", func() {
+			var validReq types.BotReqParams
+			validReq.AWSAPIKey = "blahziblahziblah"
+			validReq.AWSMetadataServerURL = "https://jibberish.execute-api.us-west-81.amazonaws.com"
+			validReq.KubeConfig = "/User/craycrayuser/.kube/config"
+			setMessage(&validReq, "@superbot  !doSomethingAwesome foo  arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen ")
+			validReq.SlackUser = "UCRAY7Q"
+
+			So(isRequestValid(validReq), ShouldBeTrue)
+		})
 		Convey("should return false for an invalid request", func() {
 			var invalidReq types.BotReqParams
 			actual := isRequestValid(invalidReq)
@@ -351,18 +352,55 @@ func TestRequestKube2IamReq(t *testing.T) {
 			validReq.AWSAPIKey = "blahziblahziblah"
 			validReq.AWSMetadataServerURL = "https://jibberish.execute-api.us-west-81.amazonaws.com"
 			validReq.KubeConfig = "/User/craycrayuser/.kube/config"
-			validReq.Message = "@superbot !doSomethingAwesome foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen"
+			setMessage(&validReq, "@superbot !doSomethingAwesome foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen")
 			validReq.SlackUser = "UCRAY7Q"
 
-			expected := `Failed to get owners of awsRoleArn=arn:aws:iam::123456789012:role/superawesome-powerful-Role3. err=doHttpRequest to getAWSAccountOwnerID url=https://jibberish.execute-api.us-west-81.amazonaws.com/dev_read/accounts?AccountNumber=123456789012 failed, err=unexpected end of JSON input`
-			actual := RequestKube2IamReq(validReq)
-			So(actual, ShouldResemble, expected)
+			expected := `Failed to get owners of awsRoleArn=arn:aws:iam::123456789012:role/superawesome-powerful-Role3. err=doHttpRequest to getAWSAccountOwnerID url=https://jibberish.execute-api.us-west-81.amazonaws.com/dev_read/accounts?AccountNumber=123456789012 failed, err=request to url=https://jibberish.execute-api.us-west-81.amazonaws.com/dev_read/accounts?AccountNumber=123456789012 failed`
+			actual := newTestBot().RequestKube2IamReq(context.Background(), validReq)
+			So(actual.Text, ShouldStartWith, expected)
+			So(actual.Text, ShouldNotContainSubstring, "JSON")
+			So(actual.Broadcast, ShouldBeFalse)
+			So(actual.Blocks, ShouldNotBeEmpty)
+			So(actual.Blocks[0].Text.Text, ShouldEqual, "kube2iam request failed")
 		})
 		Convey("should return error when called with invalid request", func() {
 			var invalidReq types.BotReqParams
 			expected := fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.RequestKube2IamBotReqFormat, invalidReq.Message)
-			actual := RequestKube2IamReq(invalidReq)
-			So(actual, ShouldResemble, expected)
+			actual := newTestBot().RequestKube2IamReq(context.Background(), invalidReq)
+			So(actual.Text, ShouldResemble, expected)
+		})
+	})
+}
+
+func TestRequestKube2IamReqPending(t *testing.T) {
+	Convey("RequestKube2IamReq from a user who doesn't own the role", t, func() {
+		srv := newOwnerLookupServer(map[string]types.ADUser{
+			"Doe, John": {FirstName: "John", LastName: "Doe", Email: "john.doe@johndoe.com"},
+		})
+		defer srv.Close()
+		fake := slack.NewFakeTransport("UBOT")
+		fake.AddUser(newTestSlackUser("UCRAY7Q", "Cray", "Cray", "cray.cray@johndoe.com"))
+		bot := NewBot(fake, newTestStore(t), srv.URL+"/groups", srv.URL, "blahziblahziblah", "/User/craycrayuser/.kube/config", srv.URL+"/users")
+		bot.Kube = newTestKube("")
+		req := utils.GetBotReqParams(bot.ADGroupLookupURL, bot.ADUserLookupURL, bot.AWSMetadataServerURL, bot.AWSAPIKey, bot.KubeConfig,
+			"<@UBOT> !requestKube2iam foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen", "UCRAY7Q")
+
+		Convey("should record a pending request the owners can approve by its ID", func() {
+			actual := bot.RequestKube2IamReq(context.Background(), req)
+			So(actual.Text, ShouldContainSubstring, "```!approveKube2iam 1```")
+			So(actual.Broadcast, ShouldBeFalse)
+			actions := actual.Blocks[len(actual.Blocks)-1]
+			So(actions.Type, ShouldEqual, types.ActionsBlock)
+			So(actions.Elements[0].Value, ShouldEqual, "1")
+
+			pending, err := bot.Store.Get("1")
+			So(err, ShouldBeNil)
+			So(pending.Requester, ShouldEqual, "UCRAY7Q")
+			So(pending.Namespace, ShouldEqual, "foo")
+			So(pending.RoleArn, ShouldEqual, "arn:aws:iam::123456789012:role/superawesome-powerful-Role3")
+			So(pending.Cluster, ShouldEqual, "hydrogen")
+			So(pending.Owners, ShouldResemble, []string{"Doe, John"})
+			So(pending.OwnerEmails, ShouldResemble, []string{"john.doe@johndoe.com"})
 		})
 	})
 }
@@ -374,7 +412,8 @@ func TestAddNewKube2IamRole(t *testing.T) {
 			currentRole := "[]"
 
 			expected := `["arn:aws:iam::123456789012:role/superawesome-powerful-Role3"]`
-			actual := addNewKube2IamRole(currentRole, testRole)
+			actual, err := addNewKube2IamRole(currentRole, testRole)
+			So(err, ShouldBeNil)
 			So(actual, ShouldResemble, expected)
 		})
 		Convey("should add new role to existing roles", func() {
@@ -382,59 +421,216 @@ func TestAddNewKube2IamRole(t *testing.T) {
 			newRole := "arn:aws:iam::123456789012:role/superawesome-powerful-Role2"
 
 			expected := `["arn:aws:iam::123456789012:role/superawesome-powerful-Role3","arn:aws:iam::123456789012:role/superawesome-powerful-Role1","arn:aws:iam::123456789012:role/superawesome-powerful-Role2"]`
-			actual := addNewKube2IamRole(current, newRole)
+			actual, err := addNewKube2IamRole(current, newRole)
+			So(err, ShouldBeNil)
 			So(actual, ShouldResemble, expected)
 		})
 		Convey("should not add duplicate roles", func() {
 			current := `["arn:aws:iam::123456789012:role/superawesome-powerful-Role3","arn:aws:iam::123456789012:role/superawesome-powerful-Role1","arn:aws:iam::123456789012:role/superawesome-powerful-Role2"]`
 			newRole := `arn:aws:iam::123456789012:role/superawesome-powerful-Role3`
 
-			actual := addNewKube2IamRole(current, newRole)
+			actual, err := addNewKube2IamRole(current, newRole)
+			So(err, ShouldBeNil)
 			So(actual, ShouldResemble, current)
 		})
+		Convey("should add a new role to a missing annotation", func() {
+			actual, err := addNewKube2IamRole("", "arn:aws:iam::123456789012:role/superawesome-powerful-Role3")
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, `["arn:aws:iam::123456789012:role/superawesome-powerful-Role3"]`)
+		})
+		Convey("should tolerate whitespace and trailing newlines", func() {
+			current := "[ \"arn:aws:iam::123456789012:role/superawesome-powerful-Role3\" ,\n \"arn:aws:iam::123456789012:role/superawesome-powerful-Role1\"]\n"
+			newRole := " arn:aws:iam::123456789012:role/superawesome-powerful-Role1\n"
+
+			expected := `["arn:aws:iam::123456789012:role/superawesome-powerful-Role3","arn:aws:iam::123456789012:role/superawesome-powerful-Role1"]`
+			actual, err := addNewKube2IamRole(current, newRole)
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, expected)
+		})
+		Convey("should collapse duplicate roles already in the annotation", func() {
+			current := `["arn:aws:iam::123456789012:role/superawesome-powerful-Role3","arn:aws:iam::123456789012:role/superawesome-powerful-Role3"]`
+			newRole := "arn:aws:iam::123456789012:role/superawesome-powerful-Role1"
+
+			expected := `["arn:aws:iam::123456789012:role/superawesome-powerful-Role3","arn:aws:iam::123456789012:role/superawesome-powerful-Role1"]`
+			actual, err := addNewKube2IamRole(current, newRole)
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, expected)
+		})
+		Convey("should keep roles with commas and escaped quotes intact", func() {
+			current := `["arn:aws:iam::123456789012:role/team,ops","arn:aws:iam::123456789012:role/say\"hi\"x"]`
+			newRole := "arn:aws:iam::123456789012:role/team"
+
+			expected := `["arn:aws:iam::123456789012:role/team,ops","arn:aws:iam::123456789012:role/say\"hi\"x","arn:aws:iam::123456789012:role/team"]`
+			actual, err := addNewKube2IamRole(current, newRole)
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, expected)
+		})
+		Convey("should fail on malformed annotations", func() {
+			for _, current := range []string{
+				`["arn:aws:iam::123456789012:role/superawesome-powerful-Role3"`,
+				`arn:aws:iam::123456789012:role/superawesome-powerful-Role3`,
+				`["arn:aws:iam::123456789012:role/superawesome-powerful-Role3",]`,
+				`[arn:aws:iam::123456789012:role/superawesome-powerful-Role3]`,
+			} {
+				_, err := addNewKube2IamRole(current, "arn:aws:iam::123456789012:role/superawesome-powerful-Role1")
+				So(err, ShouldNotBeNil)
+			}
+		})
 	})
 }
 
 func TestApproveKube2IamReq(t *testing.T) {
 	Convey("ApproveKube2IamReq", t, func() {
-		Convey("should return error when unable to get owners of role ARN", func() {
-			var validReq types.BotReqParams
-			validReq.ADGroupLookupURL = "https://adGrpLkp/api/v1/usr/get"
-			validReq.ADUserLookupURL = "https://adUsrLkp/api/v1/usr/get"
-			validReq.AWSAPIKey = "blahziblahziblah"
-			validReq.AWSMetadataServerURL = "https://jibberish.execute-api.us-west-81.amazonaws.com"
-			validReq.KubeConfig = "/User/craycrayuser/.kube/config"
-			validReq.Message = "@superbot !doSomethingAwesome foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen"
-			validReq.SlackUser = "UCRAY7Q"
+		var validReq types.BotReqParams
+		validReq.ADGroupLookupURL = "https://adGrpLkp/api/v1/usr/get"
+		validReq.ADUserLookupURL = "https://adUsrLkp/api/v1/usr/get"
+		validReq.AWSAPIKey = "blahziblahziblah"
+		validReq.AWSMetadataServerURL = "https://jibberish.execute-api.us-west-81.amazonaws.com"
+		validReq.KubeConfig = "/User/craycrayuser/.kube/config"
+		validReq.SlackUser = "UCRAY7Q"
+		bot := newTestBot()
+		bot.Store = newTestStore(t)
+		pending, _ := bot.Store.Add(types.Kube2IamRequest{Requester: "UCRAY7Q", Namespace: "foo", RoleArn: "arn:aws:iam::123456789012:role/superawesome-powerful-Role3", Cluster: "hydrogen"})
 
-			expected := `Failed to get owners of awsRoleArn=arn:aws:iam::123456789012:role/superawesome-powerful-Role3. err=doHttpRequest to getAWSAccountOwnerID url=https://jibberish.execute-api.us-west-81.amazonaws.com/dev_read/accounts?AccountNumber=123456789012 failed, err=unexpected end of JSON input`
-			actual := ApproveKube2IamReq(validReq)
-			So(actual, ShouldResemble, expected)
+		Convey("should return error when unable to get owners of role ARN", func() {
+			setMessage(&validReq, "@superbot !approveKube2iam "+pending.ID)
+
+			expected := `Failed to get owners of awsRoleArn=arn:aws:iam::123456789012:role/superawesome-powerful-Role3. err=doHttpRequest to getAWSAccountOwnerID url=https://jibberish.execute-api.us-west-81.amazonaws.com/dev_read/accounts?AccountNumber=123456789012 failed, err=request to url=https://jibberish.execute-api.us-west-81.amazonaws.com/dev_read/accounts?AccountNumber=123456789012 failed`
+			actual := bot.ApproveKube2IamReq(context.Background(), validReq)
+			So(actual.Text, ShouldStartWith, expected)
+			So(actual.Text, ShouldNotContainSubstring, "JSON")
+			So(actual.Broadcast, ShouldBeFalse)
+			_, err := bot.Store.Get(pending.ID)
+			So(err, ShouldBeNil)
+		})
+		Convey("should refuse to approve requests nobody made", func() {
+			setMessage(&validReq, "@superbot !approveKube2iam 42")
+			actual := bot.ApproveKube2IamReq(context.Background(), validReq)
+			So(actual.Text, ShouldEqual, "There is no pending kube2iam request with ID 42")
 		})
 		Convey("should return error when called with invalid request", func() {
 			var invalidReq types.BotReqParams
 			expected := fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.ApproveKube2IamBotReqFormat, invalidReq.Message)
-			actual := ApproveKube2IamReq(invalidReq)
-			So(actual, ShouldResemble, expected)
+			actual := newTestBot().ApproveKube2IamReq(context.Background(), invalidReq)
+			So(actual.Text, ShouldResemble, expected)
+		})
+		Convey("should return error when approving by namespace, role and cluster instead of request ID", func() {
+			setMessage(&validReq, "@superbot !approveKube2iam foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen")
+			actual := bot.ApproveKube2IamReq(context.Background(), validReq)
+			So(actual.Text, ShouldStartWith, "ERROR:\n Request should be of the form")
+		})
+	})
+}
+
+func TestApproveKube2IamReqByIdentifiers(t *testing.T) {
+	Convey("ApproveKube2IamReq from users who share the name of an owner", t, func() {
+		srv := newOwnerLookupServer(nil)
+		defer srv.Close()
+		fake := slack.NewFakeTransport("UBOT")
+		fake.AddUser(newTestSlackUser("UOWNER", "John", "Doe", "john.doe@johndoe.com"))
+		fake.AddUser(newTestSlackUser("UNAMESAKE", "John", "Doe", "john.doe2@johndoe.com"))
+		bot := NewBot(fake, newTestStore(t), "", srv.URL, "blahziblahziblah", "/User/craycrayuser/.kube/config", "")
+		bot.Kube = newTestKube("")
+		bot.Identity = identity.NewStatic(identity.StaticDirectory{
+			Users: []identity.StaticUser{
+				{ADUser: types.ADUser{Cn: "Doe, John", LanID: "XYZ7", Email: "john.doe@johndoe.com"}},
+				{ADUser: types.ADUser{Cn: "Doe, John", LanID: "XYZ8", Email: "john.doe2@johndoe.com"}},
+			},
+			Groups: map[string][]string{"team-42-owners": {"Doe, John"}},
+		})
+		pending, err := bot.Store.Add(types.Kube2IamRequest{Requester: "UCRAY7Q", Namespace: "foo", RoleArn: "arn:aws:iam::123456789012:role/superawesome-powerful-Role3", Cluster: "hydrogen"})
+		So(err, ShouldBeNil)
+		req := utils.GetBotReqParams("", "", bot.AWSMetadataServerURL, bot.AWSAPIKey, bot.KubeConfig, "<@UBOT> !approveKube2iam "+pending.ID, "UNAMESAKE")
+
+		Convey("should only let the owner approve", func() {
+			actual := bot.ApproveKube2IamReq(context.Background(), req)
+			So(actual.Text, ShouldStartWith, "User <@UNAMESAKE> is not allowed to approve")
+			_, err := bot.Store.Get(pending.ID)
+			So(err, ShouldBeNil)
+
+			req.SlackUser = "UOWNER"
+			actual = bot.ApproveKube2IamReq(context.Background(), req)
+			So(actual.Blocks[0].Text.Text, ShouldEqual, "kube2iam role approved")
+			_, err = bot.Store.Get(pending.ID)
+			So(err, ShouldEqual, store.ErrRequestNotFound)
 		})
 	})
 }
 
 func TestGetRespMsg(t *testing.T) {
-	Convey("getRespMsg should return a copy of supplied message as a response", t, func() {
+	Convey("getRespMsg", t, func() {
 		var req types.Message
 		req.ID = 1010
 		req.Channel = "hit-channel"
 		req.Text = "this is the most liked message"
 		req.Type = "unit-test"
 		req.User = "SUPER-HIP"
+		req.Ts = "1503435956.000247"
 
-		actual := getRespMsg(req)
+		Convey("should return a copy of supplied message as a response", func() {
+			actual := getRespMsg(req)
+
+			So(actual.Text, ShouldNotResemble, req.Text)
+			So(actual.ID, ShouldEqual, req.ID)
+			So(actual.Channel, ShouldResemble, req.Channel)
+			So(actual.Type, ShouldResemble, req.Type)
+			So(actual.User, ShouldResemble, req.User)
+		})
+		Convey("should reply in a new thread under the request", func() {
+			actual := getRespMsg(req)
+			So(actual.ThreadTs, ShouldEqual, req.Ts)
+			So(actual.Ts, ShouldBeEmpty)
+		})
+		Convey("should reply in the thread the request was made in", func() {
+			req.ThreadTs = "1503435900.000100"
+			actual := getRespMsg(req)
+			So(actual.ThreadTs, ShouldEqual, "1503435900.000100")
+		})
+	})
+}
 
-		So(actual.Text, ShouldNotResemble, req.Text)
-		So(actual.ID, ShouldEqual, req.ID)
-		So(actual.Channel, ShouldResemble, req.Channel)
-		So(actual.Type, ShouldResemble, req.Type)
-		So(actual.User, ShouldResemble, req.User)
+func TestProcessBotRquest(t *testing.T) {
+	Convey("ProcessBotRquest", t, func() {
+		fake := slack.NewFakeTransport("UBOT")
+		bot := NewBot(fake, nil, "", "", "", "", "")
+		req := types.Message{Type: types.MessageType, Channel: "C1", User: "UCRAY7Q", Ts: "1503435956.000247"}
+
+		Convey("should reply to a help request with the supported requests", func() {
+			req.Text = "<@UBOT> !help"
+			bot.ProcessBotRquest(req)
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Channel, ShouldEqual, "C1")
+			So(replies[0].ThreadTs, ShouldEqual, "1503435956.000247")
+			So(replies[0].Broadcast, ShouldBeFalse)
+			So(replies[0].Text, ShouldEqual, getSupportedRequestTypes())
+		})
+		Convey("should reply to an unknown request with the supported requests", func() {
+			req.Text = "<@UBOT> !doSomethingAwesome"
+			bot.ProcessBotRquest(req)
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Text, ShouldStartWith, "Unknown request type [!doSomethingAwesome]")
+		})
+		Convey("should split requests on any run of spaces", func() {
+			bot.KubeConfig = "/User/craycrayuser/.kube/config"
+			bot.Kube = newTestKube(`["arn:aws:iam::123456789012:role/one"]`)
+			req.Text = "<@UBOT>  !listKube2iam foo   hydrogen "
+			bot.ProcessBotRquest(req)
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Text, ShouldEqual, "Namespace=foo in cluster=hydrogen is allowed to assume\n```arn:aws:iam::123456789012:role/one```")
+		})
+		Convey("should reply to a bare mention with the supported requests", func() {
+			for _, text := range []string{"<@UBOT>", "<@UBOT> ", ""} {
+				req.Text = text
+				bot.ProcessBotRquest(req)
+			}
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 3)
+			for _, reply := range replies {
+				So(reply.Text, ShouldEqual, getSupportedRequestTypes())
+			}
+		})
 	})
 }
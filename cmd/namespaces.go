@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ashish-amarnath/slackbots/pkg/k8s"
+	"github.com/ashish-amarnath/slackbots/pkg/kube2iam"
+	"github.com/golang/glog"
+)
+
+// keyedMutex serializes work on the same key while letting work on different keys run concurrently.
+// The zero value is ready to use.
+type keyedMutex struct {
+	lock  sync.Mutex // guards locks
+	locks map[string]*refCountedMutex
+}
+
+type refCountedMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock waits for the lock on key and returns the function that releases it
+func (m *keyedMutex) Lock(key string) (unlock func()) {
+	m.lock.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*refCountedMutex)
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &refCountedMutex{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.lock.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.lock.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.lock.Unlock()
+	}
+}
+
+// patchKube2IamAllowedRoles sets the allowed roles annotation of the namespace to allowedRoles without touching the rest of its metadata.
+// The patch fails with a conflict unless the namespace is still at resourceVersion.
+func (b *Bot) patchKube2IamAllowedRoles(ctx context.Context, cluster, namespace, resourceVersion, allowedRoles string) error {
+	patch, err := kube2iam.AnnotationPatch(kube2iam.AllowedRolesAnnotation, allowedRoles, resourceVersion)
+	if err != nil {
+		return fmt.Errorf("failed to build namespace patch, err=%s", err.Error())
+	}
+	return b.Kube.PatchNamespace(ctx, cluster, namespace, patch)
+}
+
+// updateKube2IamAllowedRoles replaces the allowed roles of the namespace with what update makes of them, returning the new allowed roles.
+// Updates from the bot to one namespace take turns, and when something else changes the namespace between the read and the write
+// the namespace is read again and update reapplied.
+func (b *Bot) updateKube2IamAllowedRoles(ctx context.Context, cluster, namespace string, update func(allowedRoles string) (string, error)) (newRoleSet string, err error) {
+	unlock := b.namespaceLocks.Lock(cluster + "/" + namespace)
+	defer unlock()
+
+	err = k8s.RetryOnConflict(func() error {
+		nsObj, err := b.Kube.GetNamespace(ctx, cluster, namespace)
+		if err != nil {
+			return fmt.Errorf("Failed to get namespace definition for namepsace=%s in cluster=%s. err=%s", namespace, cluster, err.Error())
+		}
+		if newRoleSet, err = update(nsObj.Metadata.Annotations.Kube2IamAllowedRoles); err != nil {
+			return err
+		}
+		err = b.patchKube2IamAllowedRoles(ctx, cluster, namespace, nsObj.Metadata.ResourceVersion, newRoleSet)
+		if k8s.IsConflict(err) {
+			glog.V(2).Infof("Namespace=%s in cluster=%s changed since resourceVersion=%s, retrying\n", namespace, cluster, nsObj.Metadata.ResourceVersion)
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update namespace metadata for namespace=%s in cluster=%s", namespace, cluster)
+		}
+		return nil
+	})
+	if k8s.IsConflict(err) {
+		err = fmt.Errorf("failed to update namespace metadata for namespace=%s in cluster=%s, it kept changing while it was being updated", namespace, cluster)
+	}
+	return
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/k8s"
+	"github.com/ashish-amarnath/slackbots/pkg/kube2iam"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// racingKube is a NamespaceClient whose namespaces are changed by someone else right before each of the first races patches
+type racingKube struct {
+	k8s.NamespaceClient
+	races int
+}
+
+func (r *racingKube) PatchNamespace(ctx context.Context, cluster, namespace string, patch []byte) error {
+	if r.races > 0 {
+		r.races--
+		other, _ := kube2iam.AnnotationPatch("contact-email", fmt.Sprintf("racer-%d@example.com", r.races), "")
+		if err := r.NamespaceClient.PatchNamespace(ctx, cluster, namespace, other); err != nil {
+			return err
+		}
+	}
+	return r.NamespaceClient.PatchNamespace(ctx, cluster, namespace, patch)
+}
+
+func TestKeyedMutex(t *testing.T) {
+	Convey("keyedMutex", t, func() {
+		var m keyedMutex
+
+		Convey("should make work on the same key take turns", func() {
+			unlock := m.Lock("hydrogen/foo")
+			acquired := make(chan struct{})
+			go func() {
+				defer m.Lock("hydrogen/foo")()
+				close(acquired)
+			}()
+			select {
+			case <-acquired:
+				t.Fatal("acquired a lock that was held")
+			case <-time.After(50 * time.Millisecond):
+			}
+			unlock()
+			<-acquired
+		})
+		Convey("should let work on other keys run", func() {
+			defer m.Lock("hydrogen/foo")()
+			m.Lock("hydrogen/bar")()
+			m.Lock("helium/foo")()
+		})
+		Convey("should forget keys nobody holds", func() {
+			m.Lock("hydrogen/foo")()
+			So(m.locks, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestUpdateKube2IamAllowedRoles(t *testing.T) {
+	Convey("updateKube2IamAllowedRoles", t, func() {
+		bot := newTestBot()
+		kube := newTestKube(`["arn:aws:iam::123456789012:role/one"]`)
+		bot.Kube = kube
+		addRole := func(role string) func(string) (string, error) {
+			return func(allowedRoles string) (string, error) {
+				return addNewKube2IamRole(allowedRoles, role)
+			}
+		}
+
+		Convey("should reread the namespace and try again when it changes before the update", func() {
+			bot.Kube = &racingKube{NamespaceClient: kube, races: 2}
+			reads := 0
+			newRoleSet, err := bot.updateKube2IamAllowedRoles(context.Background(), "hydrogen", "foo", func(allowedRoles string) (string, error) {
+				reads++
+				return addNewKube2IamRole(allowedRoles, "arn:aws:iam::123456789012:role/two")
+			})
+			So(err, ShouldBeNil)
+			So(reads, ShouldEqual, 3)
+			So(newRoleSet, ShouldEqual, `["arn:aws:iam::123456789012:role/one","arn:aws:iam::123456789012:role/two"]`)
+
+			ns, err := kube.GetNamespace(context.Background(), "hydrogen", "foo")
+			So(err, ShouldBeNil)
+			So(ns.Metadata.Annotations.Kube2IamAllowedRoles, ShouldEqual, newRoleSet)
+			So(ns.Metadata.Annotations.ContactEmail, ShouldEqual, "racer-0@example.com")
+		})
+		Convey("should give up when the namespace keeps changing", func() {
+			bot.Kube = &racingKube{NamespaceClient: kube, races: 100}
+			_, err := bot.updateKube2IamAllowedRoles(context.Background(), "hydrogen", "foo", addRole("arn:aws:iam::123456789012:role/two"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "failed to update namespace metadata for namespace=foo in cluster=hydrogen, it kept changing while it was being updated")
+
+			ns, err := kube.GetNamespace(context.Background(), "hydrogen", "foo")
+			So(err, ShouldBeNil)
+			So(ns.Metadata.Annotations.Kube2IamAllowedRoles, ShouldEqual, `["arn:aws:iam::123456789012:role/one"]`)
+		})
+		Convey("should not patch the namespace when update fails", func() {
+			_, err := bot.updateKube2IamAllowedRoles(context.Background(), "hydrogen", "foo", func(string) (string, error) {
+				return "", fmt.Errorf("nope")
+			})
+			So(err.Error(), ShouldEqual, "nope")
+		})
+		Convey("should keep every role added by concurrent updates", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					bot.updateKube2IamAllowedRoles(context.Background(), "hydrogen", "foo", addRole(fmt.Sprintf("arn:aws:iam::123456789012:role/concurrent-%d", i)))
+				}(i)
+			}
+			wg.Wait()
+
+			ns, err := kube.GetNamespace(context.Background(), "hydrogen", "foo")
+			So(err, ShouldBeNil)
+			roles, err := kube2iam.ParseAllowedRoles(ns.Metadata.Annotations.Kube2IamAllowedRoles)
+			So(err, ShouldBeNil)
+			So(roles.Len(), ShouldEqual, 11)
+		})
+	})
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/ashish-amarnath/slackbots/pkg/utils"
+	"github.com/golang/glog"
+)
+
+const (
+	// DefaultRequestTTL is how long a kube2iam request waits for approval before it expires
+	DefaultRequestTTL = 72 * time.Hour
+	// DefaultReminderInterval is how often the owners are reminded of a pending kube2iam request
+	DefaultReminderInterval = 24 * time.Hour
+	// pendingCheckInterval is how often pending requests are checked for reminders and expiry
+	pendingCheckInterval = time.Minute
+)
+
+// isExpired reports whether req has waited longer than the bot's request TTL at now
+func (b *Bot) isExpired(req types.Kube2IamRequest, now time.Time) bool {
+	return b.RequestTTL > 0 && now.Sub(req.CreatedAt) >= b.RequestTTL
+}
+
+// isReminderDue reports whether the owners of req should be reminded of it at now
+func (b *Bot) isReminderDue(req types.Kube2IamRequest, now time.Time) bool {
+	last := req.CreatedAt
+	if req.RemindedAt.After(last) {
+		last = req.RemindedAt
+	}
+	return b.ReminderInterval > 0 && now.Sub(last) >= b.ReminderInterval
+}
+
+// watchPendingRequests reminds owners of pending requests and expires old ones until done is closed
+func (b *Bot) watchPendingRequests(done <-chan struct{}) {
+	ticker := time.NewTicker(pendingCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			b.checkPendingRequests(now)
+		case <-done:
+			return
+		}
+	}
+}
+
+// checkPendingRequests expires the pending requests that are too old at now and reminds the owners of the others
+func (b *Bot) checkPendingRequests(now time.Time) {
+	reqs, err := b.Store.List()
+	if err != nil {
+		glog.Errorf("Failed to list pending kube2iam requests. err=%s\n", err.Error())
+		return
+	}
+	for _, req := range reqs {
+		if b.isExpired(req, now) {
+			b.expireKube2IamReq(req)
+		} else if b.isReminderDue(req, now) {
+			b.remindOwners(req, now)
+		}
+	}
+}
+
+// expireKube2IamReq forgets req and tells the requester it expired
+func (b *Bot) expireKube2IamReq(req types.Kube2IamRequest) {
+	glog.V(1).Infof("Expiring kube2iam request %s\n", utils.StringifyKube2IamRequest(req))
+	if err := b.Store.Delete(req.ID); err != nil {
+		glog.Errorf("Failed to remove expired kube2iam request %s. err=%s\n", req.ID, err.Error())
+		return
+	}
+	msg := fmt.Sprintf("Your kube2iam request %s for role %s to namespace %s in cluster %s expired after %s without being approved. Please request it again if you still need it.",
+		req.ID, req.RoleArn, req.Namespace, req.Cluster, b.RequestTTL)
+	if err := b.Responder.SendDirectMessage(req.Requester, msg); err != nil {
+		glog.Errorf("Failed to tell <@%s> kube2iam request %s expired. err=%s\n", req.Requester, req.ID, err.Error())
+	}
+}
+
+// remindOwners sends each owner of req known to slack a direct message asking them to approve or deny it
+func (b *Bot) remindOwners(req types.Kube2IamRequest, now time.Time) {
+	msg := fmt.Sprintf("Reminder: <@%s> is waiting for approval of kube2iam request %s for role %s to namespace %s in cluster %s.\nTo approve it, copy paste ```%s %s```",
+		req.Requester, req.ID, req.RoleArn, req.Namespace, req.Cluster, types.ApproveKube2IamBotReq, req.ID)
+	if b.RequestTTL > 0 {
+		msg += fmt.Sprintf("\nThe request expires at %s.", req.CreatedAt.Add(b.RequestTTL).UTC().Format(time.RFC1123))
+	}
+	for _, usr := range b.getSlackUsersForOwners(req.OwnerEmails) {
+		if err := b.Responder.SendDirectMessage(usr, msg); err != nil {
+			glog.Errorf("Failed to remind <@%s> of kube2iam request %s. err=%s\n", usr, req.ID, err.Error())
+		}
+	}
+	req.RemindedAt = now
+	if err := b.Store.Update(req); err != nil {
+		glog.Errorf("Failed to record reminder of kube2iam request %s. err=%s\n", req.ID, err.Error())
+	}
+}
+
+// getSlackUsersForOwners returns the IDs of the slack users with the emails of the role owners
+func (b *Bot) getSlackUsersForOwners(emails []string) (users []string) {
+	for _, email := range emails {
+		usr, err := b.Responder.LookupUserByEmail(email)
+		if err != nil {
+			glog.Errorf("Unable to find slack user for role owner [%s]. err=%s\n", email, err.Error())
+			continue
+		}
+		users = append(users, usr.ID)
+	}
+	return
+}
+
+// ListKube2IamReqs lists the pending kube2iam requests made by the user
+func (b *Bot) ListKube2IamReqs(botReqParams types.BotReqParams) Response {
+	reqs, err := b.Store.List()
+	if err != nil {
+		resp := fmt.Sprintf("Failed to list pending kube2iam requests. err=%s", err.Error())
+		glog.Errorf(resp)
+		return Response{Text: resp}
+	}
+
+	now := time.Now()
+	var lines []string
+	for _, req := range reqs {
+		if req.Requester != botReqParams.SlackUser || b.isExpired(req, now) {
+			continue
+		}
+		line := fmt.Sprintf("%s: role %s to namespace %s in cluster %s, requested %s", req.ID, req.RoleArn, req.Namespace, req.Cluster, req.CreatedAt.UTC().Format(time.RFC1123))
+		if b.RequestTTL > 0 {
+			line += fmt.Sprintf(", expires %s", req.CreatedAt.Add(b.RequestTTL).UTC().Format(time.RFC1123))
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return Response{Text: fmt.Sprintf("<@%s>, you have no pending kube2iam requests", botReqParams.SlackUser)}
+	}
+	return Response{Text: fmt.Sprintf("<@%s>, your pending kube2iam requests are\n```%s```", botReqParams.SlackUser, strings.Join(lines, "\n"))}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/store"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckPendingRequests(t *testing.T) {
+	Convey("checkPendingRequests", t, func() {
+		fake := slack.NewFakeTransport("UBOT")
+		fake.AddUser(newTestSlackUser("UOWNER", "John", "Doe", "john.doe@johndoe.com"))
+		bot := NewBot(fake, newTestStore(t), "", "", "", "", "")
+		bot.RequestTTL = 72 * time.Hour
+		bot.ReminderInterval = 24 * time.Hour
+		createdAt := time.Unix(1531420618, 0)
+		pending, err := bot.Store.Add(types.Kube2IamRequest{
+			Requester:   "UCRAY7Q",
+			Namespace:   "foo",
+			RoleArn:     "arn:aws:iam::123456789012:role/superawesome-powerful-Role3",
+			Cluster:     "hydrogen",
+			Owners:      []string{"Doe, John", "Unknown, Owner"},
+			OwnerEmails: []string{"John.Doe@johndoe.com", "unknown.owner@johndoe.com"},
+			CreatedAt:   createdAt,
+		})
+		So(err, ShouldBeNil)
+
+		Convey("should leave new requests alone", func() {
+			bot.checkPendingRequests(createdAt.Add(time.Hour))
+			So(fake.Replies(), ShouldBeEmpty)
+		})
+		Convey("should remind the owners known to slack once per interval", func() {
+			bot.checkPendingRequests(createdAt.Add(25 * time.Hour))
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Direct, ShouldBeTrue)
+			So(replies[0].User, ShouldEqual, "UOWNER")
+			So(replies[0].Text, ShouldContainSubstring, "```!approveKube2iam "+pending.ID+"```")
+
+			bot.checkPendingRequests(createdAt.Add(26 * time.Hour))
+			So(len(fake.Replies()), ShouldEqual, 1)
+			bot.checkPendingRequests(createdAt.Add(49 * time.Hour))
+			So(len(fake.Replies()), ShouldEqual, 2)
+		})
+		Convey("should not remind anyone when reminders are disabled", func() {
+			bot.ReminderInterval = 0
+			bot.checkPendingRequests(createdAt.Add(25 * time.Hour))
+			So(fake.Replies(), ShouldBeEmpty)
+		})
+		Convey("should expire old requests and tell the requester", func() {
+			bot.checkPendingRequests(createdAt.Add(73 * time.Hour))
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Direct, ShouldBeTrue)
+			So(replies[0].User, ShouldEqual, "UCRAY7Q")
+			So(replies[0].Text, ShouldStartWith, "Your kube2iam request "+pending.ID+" for role")
+			_, err := bot.Store.Get(pending.ID)
+			So(err, ShouldEqual, store.ErrRequestNotFound)
+		})
+		Convey("should keep requests forever when expiry is disabled", func() {
+			bot.RequestTTL = 0
+			bot.ReminderInterval = 0
+			bot.checkPendingRequests(createdAt.Add(1000 * time.Hour))
+			_, err := bot.Store.Get(pending.ID)
+			So(err, ShouldBeNil)
+		})
+		Convey("should refuse to approve expired requests", func() {
+			bot.ADGroupLookupURL = "https://adGrpLkp/api/v1/usr/get"
+			bot.ADUserLookupURL = "https://adUsrLkp/api/v1/usr/get"
+			bot.AWSMetadataServerURL = "https://jibberish.execute-api.us-west-81.amazonaws.com"
+			bot.KubeConfig = "/User/craycrayuser/.kube/config"
+			var req types.BotReqParams
+			req.ADGroupLookupURL, req.ADUserLookupURL, req.AWSMetadataServerURL, req.KubeConfig = bot.ADGroupLookupURL, bot.ADUserLookupURL, bot.AWSMetadataServerURL, bot.KubeConfig
+			req.SlackUser = "UOWNER"
+			setMessage(&req, "<@UBOT> !approveKube2iam "+pending.ID)
+			actual := bot.ApproveKube2IamReq(context.Background(), req)
+			So(actual.Text, ShouldEqual, "kube2iam request "+pending.ID+" expired after 72h0m0s without being approved")
+		})
+	})
+}
+
+func TestListKube2IamReqs(t *testing.T) {
+	Convey("ListKube2IamReqs", t, func() {
+		bot := NewBot(slack.NewFakeTransport("UBOT"), newTestStore(t), "", "", "", "", "")
+		var req types.BotReqParams
+		req.SlackUser = "UCRAY7Q"
+
+		Convey("should tell users without pending requests", func() {
+			So(bot.ListKube2IamReqs(req).Text, ShouldEqual, "<@UCRAY7Q>, you have no pending kube2iam requests")
+		})
+		Convey("should list only the user's own pending requests", func() {
+			now := time.Now()
+			bot.Store.Add(types.Kube2IamRequest{Requester: "UCRAY7Q", Namespace: "foo", RoleArn: "arn:aws:iam::123456789012:role/mine", Cluster: "hydrogen", CreatedAt: now})
+			bot.Store.Add(types.Kube2IamRequest{Requester: "UOTHER", Namespace: "bar", RoleArn: "arn:aws:iam::123456789012:role/theirs", Cluster: "hydrogen", CreatedAt: now})
+			bot.Store.Add(types.Kube2IamRequest{Requester: "UCRAY7Q", Namespace: "baz", RoleArn: "arn:aws:iam::123456789012:role/old", Cluster: "hydrogen", CreatedAt: now.Add(-100 * time.Hour)})
+
+			actual := bot.ListKube2IamReqs(req).Text
+			So(actual, ShouldContainSubstring, "1: role arn:aws:iam::123456789012:role/mine to namespace foo in cluster hydrogen")
+			So(actual, ShouldContainSubstring, "expires")
+			So(actual, ShouldNotContainSubstring, "role/theirs")
+			So(actual, ShouldNotContainSubstring, "role/old")
+		})
+	})
+}
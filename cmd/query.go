@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ashish-amarnath/slackbots/pkg/k8s"
+	"github.com/ashish-amarnath/slackbots/pkg/kube2iam"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+)
+
+// isQueryValid reports whether the read-only request in botReqParams has the expected number of words
+func isQueryValid(botReqParams types.BotReqParams, length int) bool {
+	return botReqParams.KubeConfig != "" &&
+		len(botReqParams.Fields) == length
+}
+
+// ListKube2IamReq lists the roles a namespace is allowed to assume
+func (b *Bot) ListKube2IamReq(ctx context.Context, botReqParams types.BotReqParams) Response {
+	if !isQueryValid(botReqParams, types.ListKube2IamBotReqLength) {
+		return Response{Text: fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.ListKube2IamBotReqFormat, botReqParams.Message)}
+	}
+
+	var resp string
+	namespace := botReqParams.Fields[2]
+	cluster := botReqParams.Fields[3]
+	if err := k8s.ValidateNamespaceName(namespace); err != nil {
+		return invalidRequest(err)
+	}
+	if err := b.validateCluster(cluster); err != nil {
+		return invalidRequest(err)
+	}
+
+	nsObj, err := b.Kube.GetNamespace(ctx, cluster, namespace)
+	if err != nil {
+		resp = b.failure(ctx, fmt.Sprintf("reading namespace %s in cluster %s", namespace, cluster), fmt.Sprintf("Failed to get namespace definition for namepsace=%s in cluster=%s. err=%s", namespace, cluster, err.Error()))
+		glog.Errorf(resp)
+		return Response{Text: resp}
+	}
+	roles, err := kube2iam.ParseAllowedRoles(nsObj.Metadata.Annotations.Kube2IamAllowedRoles)
+	if err != nil {
+		resp = fmt.Sprintf("Namespace=%s in cluster=%s has malformed allowed roles, %s", namespace, cluster, err.Error())
+		glog.Errorf(resp)
+		return Response{Text: resp}
+	}
+	if roles.Len() == 0 {
+		return Response{Text: fmt.Sprintf("Namespace=%s in cluster=%s is not allowed to assume any roles", namespace, cluster)}
+	}
+	return Response{Text: fmt.Sprintf("Namespace=%s in cluster=%s is allowed to assume\n```%s```", namespace, cluster, strings.Join(roles.List(), "\n"))}
+}
+
+// searchClusters returns the clusters searched by queries that span clusters, every context in the kubeconfig unless Clusters is set
+func (b *Bot) searchClusters() ([]string, error) {
+	if len(b.Clusters) > 0 {
+		return b.Clusters, nil
+	}
+	return b.Kube.Clusters()
+}
+
+// WhoCanAssumeReq lists the namespaces in every configured cluster that are allowed to assume a role
+func (b *Bot) WhoCanAssumeReq(ctx context.Context, botReqParams types.BotReqParams) Response {
+	if !isQueryValid(botReqParams, types.WhoCanAssumeBotReqLength) {
+		return Response{Text: fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.WhoCanAssumeBotReqFormat, botReqParams.Message)}
+	}
+	clusters, err := b.searchClusters()
+	if err != nil {
+		resp := b.failure(ctx, "listing the clusters to search", fmt.Sprintf("Failed to list the clusters to search. err=%s", err.Error()))
+		glog.Errorf(resp)
+		return Response{Text: resp}
+	}
+	if len(clusters) == 0 {
+		return Response{Text: "No clusters are configured for the bot to search"}
+	}
+
+	awsRoleArn := botReqParams.Fields[2]
+	if err := kube2iam.ValidateRoleArn(awsRoleArn); err != nil {
+		return invalidRequest(err)
+	}
+	var granted, failed []string
+	for _, cluster := range clusters {
+		if timedOut(ctx) {
+			failed = append(failed, cluster)
+			continue
+		}
+		namespaces, err := b.getNamespacesAllowedRole(ctx, cluster, awsRoleArn)
+		if err != nil {
+			glog.Errorf("Failed to search cluster=%s for namespaces allowed to assume %s. err=%s\n", cluster, awsRoleArn, err.Error())
+			failed = append(failed, cluster)
+			continue
+		}
+		for _, ns := range namespaces {
+			granted = append(granted, fmt.Sprintf("%s/%s", cluster, ns))
+		}
+	}
+
+	var resp string
+	if len(granted) == 0 {
+		resp = fmt.Sprintf("No namespace is allowed to assume %s", awsRoleArn)
+	} else {
+		resp = fmt.Sprintf("Namespaces allowed to assume %s are\n```%s```", awsRoleArn, strings.Join(granted, "\n"))
+	}
+	if len(failed) > 0 {
+		resp += "\n" + b.failure(ctx, "searching clusters "+strings.Join(failed, ", "), fmt.Sprintf("Unable to search clusters %s", strings.Join(failed, ", ")))
+	}
+	return Response{Text: resp}
+}
+
+// getNamespacesAllowedRole returns the names of the namespaces in cluster whose allowed roles include awsRoleArn
+func (b *Bot) getNamespacesAllowedRole(ctx context.Context, cluster, awsRoleArn string) (namespaces []string, err error) {
+	nsList, err := b.Kube.ListNamespaces(ctx, cluster)
+	if err != nil {
+		return
+	}
+	return filterNamespacesAllowedRole(nsList, awsRoleArn), nil
+}
+
+// filterNamespacesAllowedRole returns the names of the namespaces in nsList whose allowed roles include awsRoleArn
+func filterNamespacesAllowedRole(nsList types.KubernetesNamespaceList, awsRoleArn string) (namespaces []string) {
+	for _, ns := range nsList.Items {
+		roles, err := kube2iam.ParseAllowedRoles(ns.Metadata.Annotations.Kube2IamAllowedRoles)
+		if err != nil {
+			glog.Errorf("Skipping namespace=%s with malformed allowed roles. err=%s\n", ns.Metadata.Name, err.Error())
+			continue
+		}
+		if roles.Contains(awsRoleArn) {
+			namespaces = append(namespaces, ns.Metadata.Name)
+		}
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/k8stest"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFilterNamespacesAllowedRole(t *testing.T) {
+	Convey("filterNamespacesAllowedRole", t, func() {
+		raw := `{"apiVersion":"v1","kind":"List","items":[
+			{"metadata":{"name":"foo","annotations":{"kube2iam.beta.nordstrom.net/allowed-roles":"[\"arn:aws:iam::123456789012:role/one\",\"arn:aws:iam::123456789012:role/two\"]"}}},
+			{"metadata":{"name":"bar","annotations":{"kube2iam.beta.nordstrom.net/allowed-roles":"[\"arn:aws:iam::123456789012:role/two\"]"}}},
+			{"metadata":{"name":"baz","annotations":{"kube2iam.beta.nordstrom.net/allowed-roles":"not json"}}},
+			{"metadata":{"name":"kube-system"}}
+		]}`
+		var nsList types.KubernetesNamespaceList
+		So(json.Unmarshal([]byte(raw), &nsList), ShouldBeNil)
+		So(len(nsList.Items), ShouldEqual, 4)
+
+		Convey("should return every namespace allowed to assume the role", func() {
+			So(filterNamespacesAllowedRole(nsList, "arn:aws:iam::123456789012:role/two"), ShouldResemble, []string{"foo", "bar"})
+			So(filterNamespacesAllowedRole(nsList, "arn:aws:iam::123456789012:role/one"), ShouldResemble, []string{"foo"})
+		})
+		Convey("should return nothing for a role no namespace may assume", func() {
+			So(filterNamespacesAllowedRole(nsList, "arn:aws:iam::123456789012:role/three"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestListKube2IamReq(t *testing.T) {
+	Convey("ListKube2IamReq", t, func() {
+		Convey("should return error when called with invalid request", func() {
+			var invalidReq types.BotReqParams
+			expected := fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.ListKube2IamBotReqFormat, invalidReq.Message)
+			So(newTestBot().ListKube2IamReq(context.Background(), invalidReq).Text, ShouldResemble, expected)
+		})
+		Convey("should return error when unable to get the namespace", func() {
+			var req types.BotReqParams
+			req.KubeConfig = "/nonexistent/kubeconfig"
+			setMessage(&req, "@superbot !listKube2iam foo hydrogen")
+			So(newTestBot().ListKube2IamReq(context.Background(), req).Text, ShouldStartWith, "Failed to get namespace definition for namepsace=foo in cluster=hydrogen")
+		})
+		Convey("should list the roles the namespace is allowed to assume", func() {
+			var req types.BotReqParams
+			req.KubeConfig = "/nonexistent/kubeconfig"
+			setMessage(&req, "@superbot !listKube2iam foo hydrogen")
+			bot := newTestBot()
+			bot.Kube = newTestKube(`["arn:aws:iam::123456789012:role/one","arn:aws:iam::123456789012:role/two"]`)
+			So(bot.ListKube2IamReq(context.Background(), req).Text, ShouldEqual, "Namespace=foo in cluster=hydrogen is allowed to assume\n```arn:aws:iam::123456789012:role/one\narn:aws:iam::123456789012:role/two```")
+		})
+	})
+}
+
+func TestWhoCanAssumeReq(t *testing.T) {
+	Convey("WhoCanAssumeReq", t, func() {
+		var req types.BotReqParams
+		req.KubeConfig = "/nonexistent/kubeconfig"
+		setMessage(&req, "@superbot !whoCanAssume arn:aws:iam::123456789012:role/superawesome-powerful-Role3")
+		bot := newTestBot()
+
+		Convey("should return error when called with invalid request", func() {
+			var invalidReq types.BotReqParams
+			expected := fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.WhoCanAssumeBotReqFormat, invalidReq.Message)
+			So(bot.WhoCanAssumeReq(context.Background(), invalidReq).Text, ShouldResemble, expected)
+		})
+		Convey("should say when no clusters are configured", func() {
+			bot.Kube = k8stest.NewClient(nil)
+			So(bot.WhoCanAssumeReq(context.Background(), req).Text, ShouldEqual, "No clusters are configured for the bot to search")
+		})
+		Convey("should report the clusters it was unable to search", func() {
+			bot.Clusters = []string{"hydrogen", "helium"}
+			bot.Kube = k8stest.NewClient(nil)
+			actual := bot.WhoCanAssumeReq(context.Background(), req).Text
+			So(actual, ShouldStartWith, "No namespace is allowed to assume arn:aws:iam::123456789012:role/superawesome-powerful-Role3")
+			So(actual, ShouldEndWith, "Unable to search clusters hydrogen, helium")
+		})
+		Convey("should find the namespaces allowed to assume the role", func() {
+			bot.Clusters = []string{"hydrogen", "helium"}
+			bot.Kube = newTestKube(`["arn:aws:iam::123456789012:role/superawesome-powerful-Role3"]`)
+			So(bot.WhoCanAssumeReq(context.Background(), req).Text, ShouldEqual, "Namespaces allowed to assume arn:aws:iam::123456789012:role/superawesome-powerful-Role3 are\n```hydrogen/foo```\nUnable to search clusters helium")
+		})
+		Convey("should search every cluster in the kubeconfig when no clusters are configured", func() {
+			bot.Kube = newTestKube(`["arn:aws:iam::123456789012:role/superawesome-powerful-Role3"]`)
+			So(bot.WhoCanAssumeReq(context.Background(), req).Text, ShouldEqual, "Namespaces allowed to assume arn:aws:iam::123456789012:role/superawesome-powerful-Role3 are\n```hydrogen/foo```")
+		})
+	})
+}
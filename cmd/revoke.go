@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ashish-amarnath/slackbots/pkg/kube2iam"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/ashish-amarnath/slackbots/pkg/utils"
+	"github.com/golang/glog"
+)
+
+// getNamespaceOwners returns the members of the AD security group of the team that owns the namespace
+func (b *Bot) getNamespaceOwners(ctx context.Context, mdsURL, mdsAPIKey string, ns types.KubernetesNamespace) (owners []types.ADUser, err error) {
+	teamID := ns.Metadata.Annotations.CloudTeamID
+	if teamID == "" {
+		err = fmt.Errorf("namespace %s has no cloud-team-id annotation", ns.Metadata.Name)
+		return
+	}
+	adSecGrp, err := b.lookupTeamADSecurityGroup(ctx, mdsURL, mdsAPIKey, teamID)
+	if err != nil {
+		glog.Errorf("Failed to translate cloud-team-id=[%s] of namespace %s to AD security group.\n", teamID, ns.Metadata.Name)
+		return
+	}
+	owners, err = b.lookupGroupMembers(ctx, adSecGrp)
+	if err != nil {
+		owners = nil
+		glog.Errorf("Failed to get members of AD security group=[%s].\n", adSecGrp)
+	}
+	return
+}
+
+// removeKube2IamRole removes role from the allowed roles annotation value currentAllowedRoles, reporting whether it was allowed
+func removeKube2IamRole(currentAllowedRoles, role string) (newRoleSet string, removed bool, err error) {
+	roles, err := kube2iam.ParseAllowedRoles(currentAllowedRoles)
+	if err != nil {
+		return
+	}
+	removed = roles.Remove(role)
+	newRoleSet = roles.String()
+	glog.V(8).Infof("newRoleSet=%s\n", newRoleSet)
+	return
+}
+
+// RevokeKube2IamReq removes a role from the allowed roles of a namespace, on behalf of an owner of either of them
+func (b *Bot) RevokeKube2IamReq(ctx context.Context, botReqParams types.BotReqParams) Response {
+	if !isRequestValid(botReqParams) {
+		return Response{Text: fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.RevokeKube2IamBotReqFormat, botReqParams.Message)}
+	}
+
+	glog.V(1).Infof("Received request %s\n", utils.StringifyBotReqParams(botReqParams))
+
+	var resp string
+	namespace := botReqParams.Fields[2]
+	awsRoleArn := botReqParams.Fields[3]
+	cluster := botReqParams.Fields[4]
+	if err := b.validateKube2IamTarget(namespace, awsRoleArn, cluster); err != nil {
+		return invalidRequest(err)
+	}
+	outcome := kube2iamOutcome{Title: "kube2iam revoke failed", Namespace: namespace, RoleArn: awsRoleArn, Cluster: cluster}
+
+	nsObj, err := b.Kube.GetNamespace(ctx, cluster, namespace)
+	if err != nil {
+		resp = b.failure(ctx, fmt.Sprintf("reading namespace %s in cluster %s", namespace, cluster),
+			fmt.Sprintf("Failed to get namespace definition for namepsace=%s in cluster=%s. err=%s", namespace, cluster, err.Error()))
+		glog.Errorf(resp)
+		outcome.Result = resp
+		return outcome.response(resp)
+	}
+
+	// owners of either the role or the namespace may revoke, so one failed lookup is not fatal
+	roleOwners, roleErr := b.getRoleOwners(ctx, botReqParams.AWSMetadataServerURL, botReqParams.AWSAPIKey, awsRoleArn)
+	nsOwners, nsErr := b.getNamespaceOwners(ctx, botReqParams.AWSMetadataServerURL, botReqParams.AWSAPIKey, nsObj)
+	if roleErr != nil && nsErr != nil {
+		resp = b.failure(ctx, fmt.Sprintf("looking up the owners of %s and namespace %s", awsRoleArn, namespace),
+			fmt.Sprintf("Failed to get owners of awsRoleArn=%s or namespace=%s. err=%s; %s", awsRoleArn, namespace, roleErr.Error(), nsErr.Error()))
+		glog.Errorf(resp)
+		outcome.Result = resp
+		return outcome.response(resp)
+	}
+	outcome.Owners = append(ownerNames(roleOwners), ownerNames(nsOwners)...)
+
+	adUsr, err := b.getADUserForSlackUser(ctx, botReqParams.SlackUser)
+	if err != nil {
+		resp = b.failure(ctx, "looking up your AD user", fmt.Sprintf("Unable to find the AD user of <@%s> to check they own role %s or namespace %s. err=%s", botReqParams.SlackUser, awsRoleArn, namespace, err.Error()))
+		glog.Errorf(resp)
+		outcome.Title, outcome.Result = "kube2iam revoke denied", resp
+		return outcome.response(resp)
+	}
+	if !isRequestorOwner(adUsr, roleOwners) && !isRequestorOwner(adUsr, nsOwners) {
+		resp = fmt.Sprintf("User <@%s> is not allowed to revoke kube2Iam role %s from namespace %s", botReqParams.SlackUser, awsRoleArn, namespace)
+		glog.Errorf(resp)
+		outcome.Title, outcome.Result = "kube2iam revoke denied", resp
+		return outcome.response(resp)
+	}
+
+	newRoleSet, err := b.updateKube2IamAllowedRoles(ctx, cluster, namespace, func(allowedRoles string) (string, error) {
+		newRoleSet, removed, err := removeKube2IamRole(allowedRoles, awsRoleArn)
+		if err != nil {
+			return "", fmt.Errorf("failed to remove role from namespace=%s, %s", namespace, err.Error())
+		}
+		if !removed {
+			return "", fmt.Errorf("Role %s is not allowed on namespace=%s.\nAllowedRoles=[%s]", awsRoleArn, namespace, allowedRoles)
+		}
+		return newRoleSet, nil
+	})
+	if err != nil {
+		resp = b.failure(ctx, fmt.Sprintf("updating namespace %s in cluster %s", namespace, cluster), err.Error())
+		glog.Errorf(resp)
+		outcome.Result = resp
+		return outcome.response(resp)
+	}
+	resp = fmt.Sprintf("Successsfully revoked role %s from namespace=%s.\nAllowedRoles=[%s]", awsRoleArn, namespace, newRoleSet)
+	outcome.Title = "kube2iam role revoked"
+	outcome.Result = fmt.Sprintf("<@%s> revoked the role.\nAllowedRoles=[%s]", botReqParams.SlackUser, newRoleSet)
+
+	// like approvals, revocations matter to the whole channel
+	revoked := outcome.response(resp)
+	revoked.Broadcast = true
+	return revoked
+}
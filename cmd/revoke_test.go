@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRemoveKube2IamRole(t *testing.T) {
+	Convey("removeKube2IamRole", t, func() {
+		Convey("should remove an allowed role and keep the others in order", func() {
+			actual, removed, err := removeKube2IamRole(`["arn:aws:iam::123456789012:role/one","arn:aws:iam::123456789012:role/two","arn:aws:iam::123456789012:role/three"]`, "arn:aws:iam::123456789012:role/two")
+			So(err, ShouldBeNil)
+			So(removed, ShouldBeTrue)
+			So(actual, ShouldEqual, `["arn:aws:iam::123456789012:role/one","arn:aws:iam::123456789012:role/three"]`)
+		})
+		Convey("should leave an empty list when the last role is removed", func() {
+			actual, removed, err := removeKube2IamRole(`["arn:aws:iam::123456789012:role/one"]`+"\n", "arn:aws:iam::123456789012:role/one")
+			So(err, ShouldBeNil)
+			So(removed, ShouldBeTrue)
+			So(actual, ShouldEqual, `[]`)
+		})
+		Convey("should report roles that are not allowed", func() {
+			_, removed, err := removeKube2IamRole(`["arn:aws:iam::123456789012:role/one"]`, "arn:aws:iam::123456789012:role/two")
+			So(err, ShouldBeNil)
+			So(removed, ShouldBeFalse)
+			_, removed, err = removeKube2IamRole("", "arn:aws:iam::123456789012:role/two")
+			So(err, ShouldBeNil)
+			So(removed, ShouldBeFalse)
+		})
+		Convey("should fail on malformed annotations", func() {
+			_, _, err := removeKube2IamRole(`["arn:aws:iam::123456789012:role/one"`, "arn:aws:iam::123456789012:role/one")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGetNamespaceOwners(t *testing.T) {
+	Convey("getNamespaceOwners", t, func() {
+		srv := newOwnerLookupServer(map[string]types.ADUser{
+			"Doe, John": {FirstName: "John", LastName: "Doe", Email: "john.doe@johndoe.com"},
+		})
+		defer srv.Close()
+		bot := NewBot(slack.NewFakeTransport("UBOT"), nil, srv.URL+"/groups", srv.URL, "blahziblahziblah", "", srv.URL+"/users")
+		var ns types.KubernetesNamespace
+		ns.Metadata.Name = "foo"
+
+		Convey("should return the members of the team named by cloud-team-id", func() {
+			ns.Metadata.Annotations.CloudTeamID = "42"
+			owners, err := bot.getNamespaceOwners(context.Background(), srv.URL, "blahziblahziblah", ns)
+			So(err, ShouldBeNil)
+			So(owners, ShouldResemble, []types.ADUser{{Cn: "Doe, John", FirstName: "John", LastName: "Doe", Email: "john.doe@johndoe.com"}})
+		})
+		Convey("should fail for namespaces without a cloud-team-id", func() {
+			_, err := bot.getNamespaceOwners(context.Background(), srv.URL, "blahziblahziblah", ns)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRevokeKube2IamReq(t *testing.T) {
+	Convey("RevokeKube2IamReq", t, func() {
+		Convey("should return error when called with invalid request", func() {
+			var invalidReq types.BotReqParams
+			expected := fmt.Sprintf("ERROR:\n Request should be of the form \n %s Order is important. Received ```%s```", types.RevokeKube2IamBotReqFormat, invalidReq.Message)
+			actual := newTestBot().RevokeKube2IamReq(context.Background(), invalidReq)
+			So(actual.Text, ShouldResemble, expected)
+		})
+		Convey("should return error when unable to get the namespace", func() {
+			var validReq types.BotReqParams
+			validReq.ADGroupLookupURL = "https://adGrpLkp/api/v1/usr/get"
+			validReq.ADUserLookupURL = "https://adUsrLkp/api/v1/usr/get"
+			validReq.AWSAPIKey = "blahziblahziblah"
+			validReq.AWSMetadataServerURL = "https://jibberish.execute-api.us-west-81.amazonaws.com"
+			validReq.KubeConfig = "/nonexistent/kubeconfig"
+			setMessage(&validReq, "@superbot !revokeKube2iam foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen")
+			validReq.SlackUser = "UCRAY7Q"
+
+			actual := newTestBot().RevokeKube2IamReq(context.Background(), validReq)
+			So(actual.Text, ShouldStartWith, "Failed to get namespace definition for namepsace=foo in cluster=hydrogen")
+			So(actual.Broadcast, ShouldBeFalse)
+			So(actual.Blocks[0].Text.Text, ShouldEqual, "kube2iam revoke failed")
+		})
+		Convey("should remove the role from the namespace when an owner revokes it", func() {
+			srv := newOwnerLookupServer(map[string]types.ADUser{
+				"Doe, John": {FirstName: "John", LastName: "Doe", Email: "john.doe@johndoe.com"},
+			})
+			defer srv.Close()
+			fake := slack.NewFakeTransport("UBOT")
+			fake.AddUser(newTestSlackUser("UOWNER", "John", "Doe", "john.doe@johndoe.com"))
+			bot := NewBot(fake, nil, srv.URL+"/groups", srv.URL, "blahziblahziblah", "/User/craycrayuser/.kube/config", srv.URL+"/users")
+			bot.Kube = newTestKube(`["arn:aws:iam::123456789012:role/one","arn:aws:iam::123456789012:role/superawesome-powerful-Role3"]`)
+
+			var req types.BotReqParams
+			req.ADGroupLookupURL = bot.ADGroupLookupURL
+			req.ADUserLookupURL = bot.ADUserLookupURL
+			req.AWSMetadataServerURL = bot.AWSMetadataServerURL
+			req.AWSAPIKey = bot.AWSAPIKey
+			req.KubeConfig = bot.KubeConfig
+			setMessage(&req, "@superbot !revokeKube2iam foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen")
+			req.SlackUser = "UOWNER"
+
+			actual := bot.RevokeKube2IamReq(context.Background(), req)
+			So(actual.Text, ShouldEqual, "Successsfully revoked role arn:aws:iam::123456789012:role/superawesome-powerful-Role3 from namespace=foo.\nAllowedRoles=[[\"arn:aws:iam::123456789012:role/one\"]]")
+			So(actual.Broadcast, ShouldBeTrue)
+			ns, err := bot.Kube.GetNamespace(context.Background(), "hydrogen", "foo")
+			So(err, ShouldBeNil)
+			So(ns.Metadata.Annotations.Kube2IamAllowedRoles, ShouldEqual, `["arn:aws:iam::123456789012:role/one"]`)
+		})
+	})
+}
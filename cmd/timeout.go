@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultRequestTimeout is how long the bot works on a request before giving up on it
+const DefaultRequestTimeout = 2 * time.Minute
+
+// requestContext returns the context bounding the lookups and cluster calls made for a single request
+func (b *Bot) requestContext() (context.Context, context.CancelFunc) {
+	if b.RequestTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), b.RequestTimeout)
+}
+
+// timedOut reports whether the request ctx bounds ran out of time
+func timedOut(ctx context.Context) bool {
+	return ctx.Err() == context.DeadlineExceeded
+}
+
+// failure returns msg, the message reporting that stage of a request failed.
+// When the request ran out of time the message names the stage instead, since the errors of a timed out call rarely say what it was for.
+func (b *Bot) failure(ctx context.Context, stage, msg string) string {
+	if !timedOut(ctx) {
+		return msg
+	}
+	return fmt.Sprintf("Timed out %s, requests must finish within %s", stage, b.RequestTimeout)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/k8s"
+	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// hungKube is a NamespaceClient whose clusters never answer, its calls only return once their context is done
+type hungKube struct {
+	k8s.NamespaceClient
+}
+
+func (hungKube) GetNamespace(ctx context.Context, cluster, namespace string) (types.KubernetesNamespace, error) {
+	<-ctx.Done()
+	return types.KubernetesNamespace{}, ctx.Err()
+}
+
+func (hungKube) ListNamespaces(ctx context.Context, cluster string) (types.KubernetesNamespaceList, error) {
+	<-ctx.Done()
+	return types.KubernetesNamespaceList{}, ctx.Err()
+}
+
+func TestRequestTimeout(t *testing.T) {
+	Convey("Requests that run out of time", t, func() {
+		// a metadata server that never answers
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer srv.Close()
+		fake := slack.NewFakeTransport("UBOT")
+		bot := NewBot(fake, nil, srv.URL+"/groups", srv.URL, "blahziblahziblah", "/User/craycrayuser/.kube/config", srv.URL+"/users")
+		bot.Kube = newTestKube("")
+		bot.RequestTimeout = 50 * time.Millisecond
+		req := types.Message{Type: types.MessageType, Channel: "C1", User: "UCRAY7Q", Ts: "1503435956.000247"}
+
+		Convey("should tell the user the owner lookup timed out", func() {
+			req.Text = "<@UBOT> !requestKube2iam foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen"
+			bot.ProcessBotRquest(req)
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Text, ShouldEqual, "Timed out looking up the owners of arn:aws:iam::123456789012:role/superawesome-powerful-Role3, requests must finish within 50ms")
+		})
+		Convey("should tell the user reading the namespace timed out", func() {
+			bot.Kube = hungKube{bot.Kube}
+			req.Text = "<@UBOT> !listKube2iam foo hydrogen"
+			bot.ProcessBotRquest(req)
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Text, ShouldEqual, "Timed out reading namespace foo in cluster hydrogen, requests must finish within 50ms")
+		})
+		Convey("should report the clusters it ran out of time to search", func() {
+			bot.Kube = hungKube{bot.Kube}
+			bot.Clusters = []string{"hydrogen", "helium"}
+			req.Text = "<@UBOT> !whoCanAssume arn:aws:iam::123456789012:role/superawesome-powerful-Role3"
+			bot.ProcessBotRquest(req)
+			replies := fake.Replies()
+			So(len(replies), ShouldEqual, 1)
+			So(replies[0].Text, ShouldEndWith, "\nTimed out searching clusters hydrogen, helium, requests must finish within 50ms")
+		})
+	})
+}
+
+func TestFailure(t *testing.T) {
+	Convey("failure", t, func() {
+		bot := &Bot{RequestTimeout: time.Minute}
+
+		Convey("should keep the message of requests that still have time", func() {
+			So(bot.failure(context.Background(), "reading namespace foo", "Failed"), ShouldEqual, "Failed")
+		})
+		Convey("should keep the message of cancelled requests", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(bot.failure(ctx, "reading namespace foo", "Failed"), ShouldEqual, "Failed")
+		})
+		Convey("should name the stage of requests that ran out of time", func() {
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+			defer cancel()
+			So(bot.failure(ctx, "reading namespace foo", "Failed"), ShouldEqual, "Timed out reading namespace foo, requests must finish within 1m0s")
+		})
+	})
+}
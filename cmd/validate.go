@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ashish-amarnath/slackbots/pkg/k8s"
+	"github.com/ashish-amarnath/slackbots/pkg/kube2iam"
+)
+
+// validateCluster returns an error unless cluster is a context in the kubeconfig of the bot
+func (b *Bot) validateCluster(cluster string) error {
+	clusters, err := b.Kube.Clusters()
+	if err != nil {
+		return fmt.Errorf("unable to look up cluster %q, %s", cluster, err.Error())
+	}
+	for _, known := range clusters {
+		if known == cluster {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not a cluster the bot manages, expected one of [%s]", cluster, strings.Join(clusters, ", "))
+}
+
+// validateKube2IamTarget checks the namespace, role ARN and cluster taken from a request before the bot acts on any of them
+func (b *Bot) validateKube2IamTarget(namespace, awsRoleArn, cluster string) error {
+	if err := k8s.ValidateNamespaceName(namespace); err != nil {
+		return err
+	}
+	if err := kube2iam.ValidateRoleArn(awsRoleArn); err != nil {
+		return err
+	}
+	return b.validateCluster(cluster)
+}
+
+// invalidRequest is the response to a request whose parameters failed validation
+func invalidRequest(err error) Response {
+	return Response{Text: fmt.Sprintf("ERROR:\n %s", err.Error())}
+}
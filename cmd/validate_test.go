@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/ashish-amarnath/slackbots/pkg/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateKube2IamTarget(t *testing.T) {
+	Convey("validateKube2IamTarget", t, func() {
+		bot := newTestBot()
+		validArn := "arn:aws:iam::123456789012:role/superawesome-powerful-Role3"
+
+		Convey("should accept a valid namespace, role and known cluster", func() {
+			So(bot.validateKube2IamTarget("foo", validArn, "hydrogen"), ShouldBeNil)
+			So(bot.validateKube2IamTarget("foo-bar-1", validArn, "hydrogen"), ShouldBeNil)
+		})
+		Convey("should reject namespaces that aren't DNS-1123 labels", func() {
+			for _, ns := range []string{"", "Foo", "foo_bar", "-foo", "foo-", "foo.bar", "../kube-system", "foo;rm", "$(id)", "`id`", "foo|id", "foo\nbar",
+				"a123456789012345678901234567890123456789012345678901234567890123"} {
+				So(bot.validateKube2IamTarget(ns, validArn, "hydrogen"), ShouldNotBeNil)
+			}
+		})
+		Convey("should reject clusters that aren't contexts in the kubeconfig", func() {
+			for _, cluster := range []string{"", "helium", "hydrogen;id", "--kubeconfig=/etc/passwd", "hydrogen --user=admin", "$(id)"} {
+				err := bot.validateKube2IamTarget("foo", validArn, cluster)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEndWith, "is not a cluster the bot manages, expected one of [hydrogen]")
+			}
+		})
+		Convey("should reject role ARNs that aren't IAM roles", func() {
+			for _, arn := range []string{"", "superawesome", "arn:aws:iam::123456789012:role/x;id", "arn:aws:iam::123456789012:role/$(id)"} {
+				So(bot.validateKube2IamTarget("foo", arn, "hydrogen"), ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestHostileRequests(t *testing.T) {
+	Convey("Requests with hostile parameters", t, func() {
+		var lookups int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&lookups, 1)
+			http.NotFound(w, r)
+		}))
+		defer srv.Close()
+		fake := slack.NewFakeTransport("UBOT")
+		bot := NewBot(fake, newTestStore(t), srv.URL+"/groups", srv.URL, "blahziblahziblah", "/User/craycrayuser/.kube/config", srv.URL+"/users")
+		bot.Kube = newTestKube("")
+		bot.Clusters = []string{"hydrogen"}
+		params := func(msg string) types.BotReqParams {
+			return utils.GetBotReqParams(bot.ADGroupLookupURL, bot.ADUserLookupURL, bot.AWSMetadataServerURL, bot.AWSAPIKey, bot.KubeConfig, msg, "UCRAY7Q")
+		}
+
+		for _, msg := range []string{
+			"<@UBOT> !requestKube2iam foo;touch${IFS}/tmp/pwned arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen",
+			"<@UBOT> !requestKube2iam foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen;id",
+			"<@UBOT> !requestKube2iam foo arn:aws:iam::123456789012:role/$(id) hydrogen",
+			"<@UBOT> !requestKube2iam foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 --context=hydrogen",
+		} {
+			Convey("should refuse "+msg+" before looking anything up", func() {
+				actual := bot.RequestKube2IamReq(context.Background(), params(msg))
+				So(actual.Text, ShouldStartWith, "ERROR:\n ")
+				So(atomic.LoadInt32(&lookups), ShouldEqual, 0)
+				pending, err := bot.Store.List()
+				So(err, ShouldBeNil)
+				So(pending, ShouldBeEmpty)
+			})
+		}
+		Convey("should refuse to revoke from a hostile namespace", func() {
+			actual := bot.RevokeKube2IamReq(context.Background(), params("<@UBOT> !revokeKube2iam `id` arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen"))
+			So(actual.Text, ShouldStartWith, "ERROR:\n ")
+			So(atomic.LoadInt32(&lookups), ShouldEqual, 0)
+		})
+		Convey("should refuse to list a hostile namespace or cluster", func() {
+			So(bot.ListKube2IamReq(context.Background(), params("<@UBOT> !listKube2iam foo|id hydrogen")).Text, ShouldStartWith, "ERROR:\n ")
+			So(bot.ListKube2IamReq(context.Background(), params("<@UBOT> !listKube2iam foo hydrogen&&id")).Text, ShouldStartWith, "ERROR:\n ")
+		})
+		Convey("should refuse to search for a hostile role", func() {
+			So(bot.WhoCanAssumeReq(context.Background(), params("<@UBOT> !whoCanAssume arn:aws:iam::123456789012:role/x>/etc/passwd")).Text, ShouldStartWith, "ERROR:\n ")
+		})
+	})
+}
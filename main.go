@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/ashish-amarnath/slackbots/cmd"
+	"github.com/ashish-amarnath/slackbots/pkg/httpclient"
+	"github.com/ashish-amarnath/slackbots/pkg/identity"
 	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/store"
 	"github.com/ashish-amarnath/slackbots/pkg/types"
-	"github.com/ashish-amarnath/slackbots/pkg/utils"
 	"github.com/golang/glog"
 )
 
@@ -20,13 +23,100 @@ var (
 	adGroupMemberLookupURL  *string
 	adLookupServerURL       *string
 	slackbotToken           *string
+	slackAPIURL             *string
+	slackAppToken           *string
+	slackSigningSecret      *string
+	eventsListenAddr        *string
+	transport               *string
 	kubeconfig              *string
+	clusters                *string
+	requestStorePath        *string
+	requestTTL              *time.Duration
+	reminderInterval        *time.Duration
+	requestTimeout          *time.Duration
+	lookupTimeout           *time.Duration
+	lookupRetries           *int
+	lookupRetryWait         *time.Duration
+	lookupCABundle          *string
+	lookupClientCert        *string
+	lookupClientKey         *string
+	identityProvider        *string
+	staticDirectory         *string
+	ldapURL                 *string
+	ldapBindDN              *string
+	ldapBindPassword        *string
+	ldapBaseDN              *string
+	ldapCABundle            *string
+	ldapStartTLS            *bool
+	admins                  *string
+	accountCacheTTL         *time.Duration
+	teamCacheTTL            *time.Duration
+	groupCacheTTL           *time.Duration
+	userCacheTTL            *time.Duration
+	failedLookupCacheTTL    *time.Duration
 )
 
 func printUsage() {
 	fmt.Println("Usage:")
 }
 
+func connectRTM() slack.Transport {
+	conn, err := slack.NewSlackServerConn(*slackbotToken)
+	if err != nil {
+		glog.Fatalf("Failed to connect to slack, err=%s\n", err.Error())
+	}
+	go func() {
+		for st := range conn.StateChanges() {
+			glog.Infof("Slack connection is now %s\n", st)
+		}
+	}()
+	return conn
+}
+
+func connectSocketMode() slack.Transport {
+	conn, err := slack.NewSocketModeConn(*slackAppToken, *slackbotToken)
+	if err != nil {
+		glog.Fatalf("Failed to connect to slack, err=%s\n", err.Error())
+	}
+	return conn
+}
+
+func listenForEvents() slack.Transport {
+	conn, err := slack.NewEventsServer(*eventsListenAddr, *slackSigningSecret, *slackbotToken)
+	if err != nil {
+		glog.Fatalf("Failed to start slack events server, err=%s\n", err.Error())
+	}
+	return conn
+}
+
+func ldapIdentity() identity.Provider {
+	tlsConfig, err := httpclient.TLSConfig(httpclient.Config{CABundle: *ldapCABundle})
+	if err != nil {
+		glog.Fatalf("Failed to configure TLS for the LDAP identity provider, err=%s\n", err.Error())
+	}
+	provider, err := identity.NewLDAP(identity.LDAPConfig{
+		URL:          *ldapURL,
+		BindDN:       *ldapBindDN,
+		BindPassword: *ldapBindPassword,
+		BaseDN:       *ldapBaseDN,
+		Timeout:      *lookupTimeout,
+		TLS:          tlsConfig,
+		StartTLS:     *ldapStartTLS,
+	})
+	if err != nil {
+		glog.Fatalf("Failed to configure the LDAP identity provider, err=%s\n", err.Error())
+	}
+	return provider
+}
+
+func staticIdentity() identity.Provider {
+	provider, err := identity.LoadStatic(*staticDirectory)
+	if err != nil {
+		glog.Fatalf("Failed to load the static identity provider, err=%s\n", err.Error())
+	}
+	return provider
+}
+
 func main() {
 	helpFlag = flag.Bool("help", false, "")
 	awsMetadataServerAPIKey = flag.String("apikey", "", "API key to use to engage AWS meta-data service")
@@ -34,7 +124,37 @@ func main() {
 	adGroupMemberLookupURL = flag.String("adgrouplookupurl", "", "URL for the AD group member list service.")
 	adLookupServerURL = flag.String("adLookupServerURL", "", "URL to lookup AD user")
 	slackbotToken = flag.String("slackbotToken", "", "Slack generated token for the bot")
-	kubeconfig = flag.String("kubeconfig", "", "Path to the kubeconfig for kubectl to use")
+	slackAPIURL = flag.String("slackAPIURL", types.SlackWebAPIURL, "Base URL of the slack Web API, e.g. to run against a local fake slack")
+	slackAppToken = flag.String("slackAppToken", "", "Slack app-level token, required by the socketmode transport")
+	slackSigningSecret = flag.String("slackSigningSecret", "", "Slack app signing secret, required by the events transport")
+	eventsListenAddr = flag.String("eventsListenAddr", ":8080", "Address the events transport listens on for slack event callbacks")
+	transport = flag.String("transport", types.TransportRTM, fmt.Sprintf("How to connect to slack, one of %s, %s or %s", types.TransportRTM, types.TransportSocketMode, types.TransportEvents))
+	kubeconfig = flag.String("kubeconfig", "", "Path to the kubeconfig whose contexts name the clusters the bot manages")
+	clusters = flag.String("clusters", "", "Comma separated kubeconfig contexts of the clusters !whoCanAssume searches, every context in -kubeconfig when unset")
+	requestTTL = flag.Duration("requestTTL", cmd.DefaultRequestTTL, "How long kube2iam requests wait for approval before they expire, 0 to never expire them")
+	reminderInterval = flag.Duration("reminderInterval", cmd.DefaultReminderInterval, "How often role owners are reminded of pending kube2iam requests, 0 to never remind them")
+	requestTimeout = flag.Duration("requestTimeout", cmd.DefaultRequestTimeout, "How long the bot works on a request before giving up on it, 0 to never give up")
+	requestStorePath = flag.String("requestStore", "kube2iam-requests.db", "Path to the file pending kube2iam requests are kept in")
+	lookupTimeout = flag.Duration("lookupTimeout", httpclient.DefaultConfig.Timeout, "How long each request to the metadata server and AD lookup services may take")
+	lookupRetries = flag.Int("lookupRetries", httpclient.DefaultConfig.Retries, "How many times requests to the metadata server and AD lookup services are retried when they fail with a 5xx")
+	lookupRetryWait = flag.Duration("lookupRetryWait", httpclient.DefaultConfig.RetryWait, "Wait before the first retry of a lookup, doubled for every further retry")
+	lookupCABundle = flag.String("lookupCABundle", "", "PEM file of CAs to trust, besides the system ones, for the metadata server and AD lookup services")
+	lookupClientCert = flag.String("lookupClientCert", "", "PEM client certificate to present to the metadata server and AD lookup services")
+	lookupClientKey = flag.String("lookupClientKey", "", "PEM key of -lookupClientCert")
+	identityProvider = flag.String("identityProvider", types.IdentityProviderREST, fmt.Sprintf("Where Slack users and the members of owner groups are looked up, one of %s, %s or %s", types.IdentityProviderREST, types.IdentityProviderLDAP, types.IdentityProviderStatic))
+	staticDirectory = flag.String("staticDirectory", "", "YAML file of the users and groups the static identity provider knows")
+	ldapURL = flag.String("ldapURL", "", "ldap:// or ldaps:// URL of the directory server the LDAP identity provider searches")
+	ldapBindDN = flag.String("ldapBindDN", "", "DN of the service account the LDAP identity provider binds as")
+	ldapBindPassword = flag.String("ldapBindPassword", "", "Password of -ldapBindDN")
+	ldapBaseDN = flag.String("ldapBaseDN", "", "DN the LDAP identity provider searches for users and groups under")
+	ldapCABundle = flag.String("ldapCABundle", "", "PEM file of CAs to trust, besides the system ones, for the directory server")
+	ldapStartTLS = flag.Bool("ldapStartTLS", false, "Upgrade ldap:// connections to the directory server with StartTLS before binding")
+	admins = flag.String("admins", "", "Comma separated IDs of the slack users allowed to run admin requests like !flushCache")
+	accountCacheTTL = flag.Duration("accountCacheTTL", cmd.DefaultLookupTTLs.Accounts, "How long the team owning an AWS account is cached, 0 to not cache it")
+	teamCacheTTL = flag.Duration("teamCacheTTL", cmd.DefaultLookupTTLs.Teams, "How long the AD security group of a team is cached, 0 to not cache it")
+	groupCacheTTL = flag.Duration("groupCacheTTL", cmd.DefaultLookupTTLs.Groups, "How long the members of an AD security group are cached, 0 to not cache them")
+	userCacheTTL = flag.Duration("userCacheTTL", cmd.DefaultLookupTTLs.Users, "How long the AD user of a slack user is cached, 0 to not cache it")
+	failedLookupCacheTTL = flag.Duration("failedLookupCacheTTL", cmd.DefaultLookupTTLs.Failures, "How long failed lookups are cached before they are tried again, 0 to not cache them")
 	flag.Parse()
 
 	if *helpFlag {
@@ -42,20 +162,65 @@ func main() {
 		os.Exit(1)
 	}
 
-	slackConn := slack.NewSlackServerConn(*slackbotToken)
+	slack.APIBaseURL = *slackAPIURL
 
-	glog.V(1).Infoln("Slackbot listening for messages to process...")
-	for {
-		msg, err := slackConn.ReadMessage()
-		if err != nil {
-			glog.Errorf("Failed to read message sent to slackbot. err=%s\n", err.Error())
-			continue
-		}
-		if msg.Type != types.MessageType || !strings.HasPrefix(msg.Text, "<@"+slackConn.UserID+">") {
-			glog.V(9).Infof("Ignoring message %s\n", utils.StringifyMessage(msg))
-			continue
-		}
+	lookupClient, err := httpclient.New(httpclient.Config{
+		Timeout:    *lookupTimeout,
+		Retries:    *lookupRetries,
+		RetryWait:  *lookupRetryWait,
+		CABundle:   *lookupCABundle,
+		ClientCert: *lookupClientCert,
+		ClientKey:  *lookupClientKey,
+	})
+	if err != nil {
+		glog.Fatalf("Failed to create the lookup HTTP client, err=%s\n", err.Error())
+	}
+	cmd.LookupClient = lookupClient
 
-		go cmd.ProcessBotRquest(slackConn, msg, *adGroupMemberLookupURL, *awsMetadataServerURL, *awsMetadataServerAPIKey, *kubeconfig, *adLookupServerURL)
+	requestStore, err := store.NewBoltStore(*requestStorePath)
+	if err != nil {
+		glog.Fatalf("Failed to open kube2iam request store, err=%s\n", err.Error())
+	}
+
+	var conn slack.Transport
+	switch *transport {
+	case types.TransportRTM:
+		conn = connectRTM()
+	case types.TransportSocketMode:
+		conn = connectSocketMode()
+	case types.TransportEvents:
+		conn = listenForEvents()
+	default:
+		glog.Fatalf("Unknown transport [%s]\n", *transport)
+	}
+
+	bot := cmd.NewBot(conn, requestStore, *adGroupMemberLookupURL, *awsMetadataServerURL, *awsMetadataServerAPIKey, *kubeconfig, *adLookupServerURL)
+	if *clusters != "" {
+		bot.Clusters = strings.Split(*clusters, ",")
+	}
+	bot.RequestTTL = *requestTTL
+	bot.ReminderInterval = *reminderInterval
+	bot.RequestTimeout = *requestTimeout
+	bot.Lookups = cmd.NewLookupCache(cmd.LookupTTLs{
+		Accounts: *accountCacheTTL,
+		Teams:    *teamCacheTTL,
+		Groups:   *groupCacheTTL,
+		Users:    *userCacheTTL,
+		Failures: *failedLookupCacheTTL,
+	})
+	if *admins != "" {
+		bot.Admins = strings.Split(*admins, ",")
+	}
+	switch *identityProvider {
+	case types.IdentityProviderREST:
+		// NewBot already looks people up with the AD lookup services
+	case types.IdentityProviderLDAP:
+		bot.Identity = ldapIdentity()
+	case types.IdentityProviderStatic:
+		bot.Identity = staticIdentity()
+	default:
+		glog.Fatalf("Unknown identity provider [%s]\n", *identityProvider)
 	}
+	err = bot.Run(conn)
+	glog.Fatalf("Slackbot stopped, err=%s\n", err.Error())
 }
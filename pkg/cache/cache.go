@@ -0,0 +1,153 @@
+// Package cache keeps the results of slow lookups for a while, failed lookups included.
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// entry is a cached lookup result and when it expires
+type entry[V any] struct {
+	value   V
+	err     error
+	expires time.Time
+}
+
+// call is a lookup in flight, whose result concurrent Gets of its key wait for
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+	// retry reports whether the Gets waiting for the lookup should make it again, since it failed because the
+	// context of the Get making it was done, or didn't return at all
+	retry bool
+}
+
+// Cache is a concurrency-safe cache of lookup results by key.
+// Successful lookups are kept for the TTL and failed ones for the negative TTL, so a struggling service isn't
+// asked again by every request. Lookups aren't cached when their TTL isn't positive.
+type Cache[V any] struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	// now is the clock entries expire by, replaced by tests
+	now func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]entry[V]
+	calls   map[string]*call[V]
+	// gen changes whenever results are forgotten, so lookups in flight at the time aren't cached
+	gen uint64
+}
+
+// New creates a Cache that keeps successful lookups for ttl and failed ones for negativeTTL
+func New[V any](ttl, negativeTTL time.Duration) *Cache[V] {
+	return &Cache[V]{ttl: ttl, negativeTTL: negativeTTL, now: time.Now, entries: make(map[string]entry[V]), calls: make(map[string]*call[V])}
+}
+
+// Get returns the result cached for key, or else looks it up with lookup and caches its result.
+// Concurrent Gets of a key make one lookup, whose result they all return.
+// Lookups that fail because ctx is done aren't cached, since it's the request that ran out of time rather than the lookup that failed.
+func (c *Cache[V]) Get(ctx context.Context, key string, lookup func(ctx context.Context) (V, error)) (V, error) {
+	for {
+		c.lock.Lock()
+		e, ok := c.entries[key]
+		if ok && c.now().Before(e.expires) {
+			c.lock.Unlock()
+			return e.value, e.err
+		}
+		inFlight, ok := c.calls[key]
+		if !ok {
+			cl := &call[V]{done: make(chan struct{})}
+			c.calls[key] = cl
+			gen := c.gen
+			c.lock.Unlock()
+			return c.lookup(ctx, key, cl, gen, lookup)
+		}
+		c.lock.Unlock()
+
+		select {
+		case <-inFlight.done:
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+		if !inFlight.retry {
+			return inFlight.value, inFlight.err
+		}
+	}
+}
+
+// lookup makes the lookup cl of key, caching its result unless results were forgotten since generation gen
+func (c *Cache[V]) lookup(ctx context.Context, key string, cl *call[V], gen uint64, lookup func(ctx context.Context) (V, error)) (V, error) {
+	cl.retry = true
+	defer func() {
+		c.lock.Lock()
+		delete(c.calls, key)
+		c.lock.Unlock()
+		close(cl.done)
+	}()
+
+	value, err := lookup(ctx)
+	ttl := c.ttl
+	retry := false
+	if err != nil {
+		ttl = c.negativeTTL
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			ttl = 0
+			retry = true
+		}
+	}
+	cl.value, cl.err, cl.retry = value, err, retry
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if ttl > 0 && gen == c.gen {
+		c.entries[key] = entry[V]{value: value, err: err, expires: c.now().Add(ttl)}
+	} else {
+		delete(c.entries, key)
+	}
+	c.prune()
+	return value, err
+}
+
+// prune forgets expired entries, the caller must hold the lock
+func (c *Cache[V]) prune() {
+	now := c.now()
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Delete forgets the result cached for key, reporting whether there was one
+func (c *Cache[V]) Delete(key string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.prune()
+	c.gen++
+	_, ok := c.entries[key]
+	delete(c.entries, key)
+	return ok
+}
+
+// Flush forgets every cached result, returning how many there were
+func (c *Cache[V]) Flush() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.prune()
+	c.gen++
+	n := len(c.entries)
+	c.entries = make(map[string]entry[V])
+	return n
+}
+
+// Len returns how many results are cached
+func (c *Cache[V]) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.prune()
+	return len(c.entries)
+}
@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// counter is a lookup that counts its calls, failing with err when it is set
+type counter struct {
+	lock  sync.Mutex
+	calls int
+	err   error
+}
+
+func (c *counter) lookup(ctx context.Context) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.calls++
+	if c.err != nil {
+		return "", c.err
+	}
+	return fmt.Sprintf("value-%d", c.calls), nil
+}
+
+// blocked wraps the lookup of c so that its first call waits until release is closed or its context is done
+func (c *counter) blocked(started, release chan struct{}) func(ctx context.Context) (string, error) {
+	var once sync.Once
+	return func(ctx context.Context) (string, error) {
+		first := false
+		once.Do(func() { first = true })
+		if first {
+			close(started)
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+		return c.lookup(ctx)
+	}
+}
+
+func TestCache(t *testing.T) {
+	Convey("A Cache", t, func() {
+		now := time.Date(2017, 8, 22, 0, 0, 0, 0, time.UTC)
+		c := New[string](time.Hour, time.Minute)
+		c.now = func() time.Time { return now }
+		lookup := &counter{}
+		ctx := context.Background()
+
+		Convey("should keep lookups for the TTL", func() {
+			v, err := c.Get(ctx, "k", lookup.lookup)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "value-1")
+			now = now.Add(59 * time.Minute)
+			v, _ = c.Get(ctx, "k", lookup.lookup)
+			So(v, ShouldEqual, "value-1")
+			now = now.Add(time.Minute)
+			v, _ = c.Get(ctx, "k", lookup.lookup)
+			So(v, ShouldEqual, "value-2")
+			So(lookup.calls, ShouldEqual, 2)
+		})
+		Convey("should keep failed lookups for the negative TTL", func() {
+			lookup.err = errors.New("service unavailable")
+			_, err := c.Get(ctx, "k", lookup.lookup)
+			So(err, ShouldEqual, lookup.err)
+			_, err = c.Get(ctx, "k", lookup.lookup)
+			So(err, ShouldEqual, lookup.err)
+			So(lookup.calls, ShouldEqual, 1)
+
+			lookup.err = nil
+			now = now.Add(time.Minute)
+			v, err := c.Get(ctx, "k", lookup.lookup)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "value-2")
+		})
+		Convey("should not keep lookups that failed because the request ran out of time", func() {
+			lookup.err = fmt.Errorf("lookup failed, err=%w", context.DeadlineExceeded)
+			c.Get(ctx, "k", lookup.lookup)
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+			lookup.err = errors.New("connection closed")
+			c.Get(cancelled, "k", lookup.lookup)
+			c.Get(ctx, "k", lookup.lookup)
+			So(lookup.calls, ShouldEqual, 3)
+		})
+		Convey("should not keep anything when its TTLs aren't positive", func() {
+			c = New[string](0, 0)
+			c.Get(ctx, "k", lookup.lookup)
+			c.Get(ctx, "k", lookup.lookup)
+			So(lookup.calls, ShouldEqual, 2)
+			So(c.Len(), ShouldEqual, 0)
+		})
+		Convey("should forget the lookups it is told to", func() {
+			c.Get(ctx, "a", lookup.lookup)
+			c.Get(ctx, "b", lookup.lookup)
+			c.Get(ctx, "c", lookup.lookup)
+			So(c.Delete("a"), ShouldBeTrue)
+			So(c.Delete("a"), ShouldBeFalse)
+			v, _ := c.Get(ctx, "a", lookup.lookup)
+			So(v, ShouldEqual, "value-4")
+			So(c.Flush(), ShouldEqual, 3)
+			So(c.Len(), ShouldEqual, 0)
+		})
+		Convey("should not count expired lookups", func() {
+			c.Get(ctx, "a", lookup.lookup)
+			now = now.Add(time.Hour)
+			So(c.Len(), ShouldEqual, 0)
+			So(c.Delete("a"), ShouldBeFalse)
+		})
+		Convey("should make one lookup for concurrent Gets of a key", func() {
+			started, release := make(chan struct{}), make(chan struct{})
+			blocked := lookup.blocked(started, release)
+			values := make(chan string, 10)
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					v, _ := c.Get(ctx, "k", blocked)
+					values <- v
+				}()
+			}
+			<-started
+			time.Sleep(10 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(values)
+			for v := range values {
+				So(v, ShouldEqual, "value-1")
+			}
+			So(lookup.calls, ShouldEqual, 1)
+		})
+		Convey("should look up again for Gets waiting on a lookup that ran out of time", func() {
+			started, release := make(chan struct{}), make(chan struct{})
+			blocked := lookup.blocked(started, release)
+			timingOut, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() {
+				_, err := c.Get(timingOut, "k", blocked)
+				done <- err
+			}()
+			<-started
+			waited := make(chan string)
+			go func() {
+				v, _ := c.Get(ctx, "k", blocked)
+				waited <- v
+			}()
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+			So(<-done, ShouldEqual, context.Canceled)
+			So(<-waited, ShouldEqual, "value-1")
+			So(c.Len(), ShouldEqual, 1)
+		})
+		Convey("should not keep lookups in flight when the cache is flushed", func() {
+			started, release := make(chan struct{}), make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				c.Get(ctx, "k", lookup.blocked(started, release))
+				close(done)
+			}()
+			<-started
+			c.Flush()
+			close(release)
+			<-done
+			So(c.Len(), ShouldEqual, 0)
+		})
+		Convey("should be safe to use concurrently", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					c.Get(ctx, fmt.Sprintf("k%d", i%5), lookup.lookup)
+					if i%10 == 0 {
+						c.Flush()
+					}
+				}(i)
+			}
+			wg.Wait()
+			So(c.Len(), ShouldBeLessThanOrEqualTo, 5)
+		})
+	})
+}
@@ -0,0 +1,182 @@
+// Package httpclient is the HTTP client the bot looks owners and users up with.
+// It checks status codes, retries server errors and can be configured with the TLS settings of internal services.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// maxBodySize bounds how much of a response the client reads
+const maxBodySize = 10 << 20
+
+// Config configures a Client
+type Config struct {
+	// Timeout bounds each attempt of a request, from dialing to reading the body
+	Timeout time.Duration
+	// Retries is how many more times a request answered with a 5xx is attempted
+	Retries int
+	// RetryWait is the wait before the first retry, doubled for every further retry.
+	// Every wait is jittered so clients that failed together don't retry together.
+	RetryWait time.Duration
+	// CABundle is a PEM file of CAs trusted in addition to the system roots
+	CABundle string
+	// ClientCert and ClientKey are the PEM files of the certificate presented to services that ask for one
+	ClientCert string
+	ClientKey  string
+}
+
+// DefaultConfig is the configuration of the client returned by Default
+var DefaultConfig = Config{
+	Timeout:   10 * time.Second,
+	Retries:   2,
+	RetryWait: 200 * time.Millisecond,
+}
+
+// StatusError is returned for responses with a status other than 2xx
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request to url=%s failed with %d", e.URL, e.StatusCode)
+}
+
+// Client makes GET requests with the policy of its Config
+type Client struct {
+	http *http.Client
+	cfg  Config
+	wait func(ctx context.Context, d time.Duration) error
+}
+
+// New creates a Client, loading the TLS files named by cfg
+func New(cfg Config) (*Client, error) {
+	tlsConfig, err := TLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		http: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		cfg:  cfg,
+		wait: wait,
+	}, nil
+}
+
+// Default returns a Client with DefaultConfig
+func Default() *Client {
+	c, err := New(DefaultConfig)
+	if err != nil {
+		// DefaultConfig names no files, so there is nothing to fail
+		panic(err)
+	}
+	return c
+}
+
+// TLSConfig returns the TLS configuration for the CA bundle and client certificate named by cfg, ignoring the rest of it.
+// Clients of services that aren't reached over HTTP use it to trust the same CAs.
+func TLSConfig(cfg Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle, err=%s", err.Error())
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s has no PEM certificates", cfg.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate, err=%s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// wait waits for d, or until ctx is done
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryWait returns the jittered wait before retry number retry, counting from 1
+func (c *Client) retryWait(retry int) time.Duration {
+	wait := c.cfg.RetryWait << uint(retry-1)
+	if wait <= 0 {
+		return 0
+	}
+	// somewhere between half and all of the wait
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// Get fetches url with header, returning the body of a 2xx response.
+// It gives up, retries included, when ctx is done, returning ctx's error along with the error of the last attempt.
+func (c *Client) Get(ctx context.Context, url string, header http.Header) (body []byte, err error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if waitErr := c.wait(ctx, c.retryWait(attempt)); waitErr != nil {
+				return nil, fmt.Errorf("gave up retrying url=%s err=%w, last attempt err=%w", url, waitErr, err)
+			}
+		}
+		var status int
+		body, status, err = c.get(ctx, url, header, attempt)
+		if err == nil || status < 500 || attempt >= c.cfg.Retries {
+			return
+		}
+		glog.V(2).Infof("GET %s failed with %d, retrying\n", url, status)
+	}
+}
+
+// get makes a single attempt at fetching url
+func (c *Client) get(ctx context.Context, url string, header http.Header, attempt int) (body []byte, status int, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request to url=%s err=%s", url, err.Error())
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		glog.V(4).Infof("GET %s attempt=%d failed after %s\n", url, attempt+1, time.Since(start))
+		return nil, 0, fmt.Errorf("request to url=%s failed err=%w", url, err)
+	}
+	defer resp.Body.Close()
+	body, err = io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	glog.V(4).Infof("GET %s attempt=%d status=%d in %s\n", url, attempt+1, resp.StatusCode, time.Since(start))
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response from url=%s err=%s", url, err.Error())
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, resp.StatusCode, &StatusError{URL: url, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, resp.StatusCode, nil
+}
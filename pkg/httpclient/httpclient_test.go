@@ -0,0 +1,201 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newTestClient returns a Client with cfg that records its waits instead of waiting
+func newTestClient(cfg Config) (*Client, *[]time.Duration) {
+	c, err := New(cfg)
+	So(err, ShouldBeNil)
+	var waits []time.Duration
+	c.wait = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	return c, &waits
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1, usable by servers and clients, and its key to dir
+func writeTestCert(t *testing.T, dir, name string) (certFile, keyFile string, cert tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err = os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestGet(t *testing.T) {
+	Convey("Get", t, func() {
+		var requests int32
+		statuses := []int{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := int(atomic.AddInt32(&requests, 1))
+			if r.URL.Path == "/slow" {
+				time.Sleep(200 * time.Millisecond)
+			}
+			if n <= len(statuses) {
+				w.WriteHeader(statuses[n-1])
+			}
+			w.Write([]byte(r.Header.Get("X-Api-Key")))
+		}))
+		defer srv.Close()
+		c, waits := newTestClient(Config{Timeout: time.Second, Retries: 2, RetryWait: 100 * time.Millisecond})
+
+		Convey("should return the body of a successful response", func() {
+			body, err := c.Get(context.Background(), srv.URL, http.Header{"X-Api-Key": {"secret"}})
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, "secret")
+			So(*waits, ShouldBeEmpty)
+		})
+		Convey("should retry server errors with growing jittered waits", func() {
+			statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable}
+			body, err := c.Get(context.Background(), srv.URL, http.Header{"X-Api-Key": {"secret"}})
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, "secret")
+			So(atomic.LoadInt32(&requests), ShouldEqual, 3)
+			So(*waits, ShouldHaveLength, 2)
+			So((*waits)[0], ShouldBeBetweenOrEqual, 50*time.Millisecond, 100*time.Millisecond)
+			So((*waits)[1], ShouldBeBetweenOrEqual, 100*time.Millisecond, 200*time.Millisecond)
+		})
+		Convey("should give up after the configured retries", func() {
+			statuses = []int{500, 500, 500, 500}
+			_, err := c.Get(context.Background(), srv.URL, nil)
+			So(err, ShouldNotBeNil)
+			So(err.(*StatusError).StatusCode, ShouldEqual, 500)
+			So(atomic.LoadInt32(&requests), ShouldEqual, 3)
+		})
+		Convey("should not retry client errors", func() {
+			statuses = []int{http.StatusNotFound}
+			_, err := c.Get(context.Background(), srv.URL, nil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "request to url="+srv.URL+" failed with 404")
+			So(atomic.LoadInt32(&requests), ShouldEqual, 1)
+		})
+		Convey("should time requests out", func() {
+			c, _ := newTestClient(Config{Timeout: 50 * time.Millisecond})
+			_, err := c.Get(context.Background(), srv.URL+"/slow", nil)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should stop retrying when the context is done", func() {
+			statuses = []int{500, 500, 500, 500}
+			ctx, cancel := context.WithCancel(context.Background())
+			c.wait = func(ctx context.Context, d time.Duration) error {
+				cancel()
+				return ctx.Err()
+			}
+			_, err := c.Get(ctx, srv.URL, nil)
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			var statusErr *StatusError
+			So(errors.As(err, &statusErr), ShouldBeTrue)
+			So(statusErr.StatusCode, ShouldEqual, 500)
+			So(atomic.LoadInt32(&requests), ShouldEqual, 1)
+		})
+		Convey("should give up on requests when the context times out", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := c.Get(ctx, srv.URL+"/slow", nil)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		})
+		Convey("should fail for urls it can't request", func() {
+			_, err := c.Get(context.Background(), "foobar.baz", nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTLS(t *testing.T) {
+	Convey("TLS", t, func() {
+		dir := t.TempDir()
+		serverCertFile, _, serverCert := writeTestCert(t, dir, "server")
+		clientCertFile, clientKeyFile, clientCert := writeTestCert(t, dir, "client")
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(clientCert.Leaf)
+
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}))
+		srv.TLS = &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+		}
+		srv.StartTLS()
+		defer srv.Close()
+
+		Convey("should trust the CA bundle and present the client certificate", func() {
+			c, _ := newTestClient(Config{Timeout: time.Second, CABundle: serverCertFile, ClientCert: clientCertFile, ClientKey: clientKeyFile})
+			body, err := c.Get(context.Background(), srv.URL, nil)
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, "client")
+		})
+		Convey("should not trust servers outside the CA bundle", func() {
+			c, _ := newTestClient(Config{Timeout: time.Second, CABundle: clientCertFile, ClientCert: clientCertFile, ClientKey: clientKeyFile})
+			_, err := c.Get(context.Background(), srv.URL, nil)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail without a client certificate when the server requires one", func() {
+			c, _ := newTestClient(Config{Timeout: time.Second, CABundle: serverCertFile})
+			_, err := c.Get(context.Background(), srv.URL, nil)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should refuse TLS files it can't load", func() {
+			_, err := New(Config{CABundle: filepath.Join(dir, "missing.crt")})
+			So(err, ShouldNotBeNil)
+			_, err = New(Config{CABundle: clientKeyFile})
+			So(err, ShouldNotBeNil)
+			_, err = New(Config{ClientCert: clientCertFile})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,50 @@
+// Package identity maps Slack users to the people in a directory and lists the members of directory groups.
+package identity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+)
+
+// Provider resolves Slack users to directory users and lists the members of directory groups
+type Provider interface {
+	// ResolveSlackUser returns the directory user who is the Slack user su
+	ResolveSlackUser(ctx context.Context, su types.SlackUser) (types.ADUser, error)
+	// GroupMembers returns the users in the directory group and the groups nested in it, each with an identifier SameUser can match them by
+	GroupMembers(ctx context.Context, group string) ([]types.ADUser, error)
+}
+
+// SameUser reports whether a and b are the same directory user by the email addresses, LanIDs and employee numbers they have.
+// Names aren't compared since people share and change them. Users with no identifier in common are never the same,
+// and neither are users with any identifier in common that differs.
+func SameUser(a, b types.ADUser) bool {
+	matched := false
+	for _, ids := range [][2]string{{a.Email, b.Email}, {a.LanID, b.LanID}, {a.EmployeeNumber, b.EmployeeNumber}} {
+		if ids[0] == "" || ids[1] == "" {
+			continue
+		}
+		if !strings.EqualFold(ids[0], ids[1]) {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// hasIdentifier reports whether SameUser can match usr with anyone
+func hasIdentifier(usr types.ADUser) bool {
+	return usr.Email != "" || usr.LanID != "" || usr.EmployeeNumber != ""
+}
+
+// errNoIdentifier is returned for members of group who can't be told apart from other users with the same name
+func errNoIdentifier(group string, usr types.ADUser) error {
+	return fmt.Errorf("member %s of group %s has no email address, LanID or employee number to match them by", usr.Cn, group)
+}
+
+// errNoEmail is returned for Slack users whose profile doesn't have the email address directory users are matched by
+func errNoEmail(su types.SlackUser) error {
+	return fmt.Errorf("slack user %s has no email address to look up in the directory", su.ID)
+}
@@ -0,0 +1,27 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSameUser(t *testing.T) {
+	Convey("SameUser", t, func() {
+		john := types.ADUser{Cn: "Doe, John", LanID: "XYZ7", Email: "John.Doe@johndoe.com", EmployeeNumber: "007"}
+		Convey("should match users by any identifier they both have, ignoring case", func() {
+			So(SameUser(john, types.ADUser{Email: "john.doe@JOHNDOE.com"}), ShouldBeTrue)
+			So(SameUser(types.ADUser{LanID: "xyz7"}, john), ShouldBeTrue)
+			So(SameUser(john, types.ADUser{EmployeeNumber: "007", Cn: "D, Johnny"}), ShouldBeTrue)
+		})
+		Convey("should not match users by name", func() {
+			So(SameUser(john, types.ADUser{Cn: "Doe, John", FirstName: "John", LastName: "Doe"}), ShouldBeFalse)
+			So(SameUser(types.ADUser{}, types.ADUser{}), ShouldBeFalse)
+		})
+		Convey("should not match users when any identifier they both have differs", func() {
+			So(SameUser(john, types.ADUser{Email: "john.doe@johndoe.com", EmployeeNumber: "008"}), ShouldBeFalse)
+			So(SameUser(john, types.ADUser{LanID: "XYZ8"}), ShouldBeFalse)
+		})
+	})
+}
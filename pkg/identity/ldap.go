@@ -0,0 +1,274 @@
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang/glog"
+)
+
+// LDAPConfig configures an LDAP provider
+type LDAPConfig struct {
+	// URL is the ldap:// or ldaps:// URL of the directory server
+	URL string
+	// BindDN and BindPassword are the credentials of the service account the provider searches the directory as
+	BindDN       string
+	BindPassword string
+	// BaseDN is where users and groups are searched for
+	BaseDN string
+	// Timeout bounds connecting to the directory server and each operation on it
+	Timeout time.Duration
+	// TLS configures ldaps:// connections and StartTLS, trusting the system CAs when nil
+	TLS *tls.Config
+	// StartTLS upgrades ldap:// connections to TLS before binding
+	StartTLS bool
+}
+
+// LDAP is the Provider that searches an Active Directory, or any LDAP directory with its attributes, directly.
+// Users are looked up by the email address of their Slack profile, and the members of a group are the union
+// of the group's member attribute and the users whose memberOf attribute names the group.
+type LDAP struct {
+	cfg LDAPConfig
+}
+
+var _ Provider = &LDAP{}
+
+// userAttributes are the attributes of directory users the provider reads
+var userAttributes = []string{"cn", "sAMAccountName", "givenName", "sn", "mail", "manager", "employeeNumber"}
+
+// NewLDAP creates an LDAP provider for cfg
+func NewLDAP(cfg LDAPConfig) (*LDAP, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, fmt.Errorf("the LDAP provider needs the URL of the directory server and the base DN to search")
+	}
+	if cfg.StartTLS && strings.HasPrefix(strings.ToLower(cfg.URL), "ldaps://") {
+		return nil, fmt.Errorf("StartTLS is for ldap:// URLs, %s is already encrypted", cfg.URL)
+	}
+	if cfg.BindPassword != "" && !cfg.StartTLS && !strings.HasPrefix(strings.ToLower(cfg.URL), "ldaps://") {
+		glog.Warningf("The LDAP provider sends the password of %s to %s unencrypted, use ldaps:// or StartTLS\n", cfg.BindDN, cfg.URL)
+	}
+	return &LDAP{cfg: cfg}, nil
+}
+
+// connect dials the directory server and binds as the service account.
+// The connection is closed, interrupting whatever it is doing, when ctx is done.
+func (l *LDAP) connect(ctx context.Context) (conn *ldap.Conn, closeConn func(), err error) {
+	conn, err = ldap.DialURL(l.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: l.cfg.Timeout}), ldap.DialWithTLSConfig(l.tlsConfig()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to LDAP server=%s, err=%s", l.cfg.URL, err.Error())
+	}
+	if l.cfg.Timeout > 0 {
+		conn.SetTimeout(l.cfg.Timeout)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	closeConn = func() {
+		stop()
+		conn.Close()
+	}
+	if l.cfg.StartTLS {
+		if err = conn.StartTLS(l.tlsConfig()); err != nil {
+			closeConn()
+			return nil, nil, fmt.Errorf("failed to start TLS with LDAP server=%s, err=%s", l.cfg.URL, err.Error())
+		}
+	}
+	if err = conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+		closeConn()
+		return nil, nil, fmt.Errorf("failed to bind to LDAP server=%s as %s, err=%s", l.cfg.URL, l.cfg.BindDN, err.Error())
+	}
+	return conn, closeConn, nil
+}
+
+// tlsConfig returns the TLS configuration for the directory server, verifying it by the host of its URL
+func (l *LDAP) tlsConfig() *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if l.cfg.TLS != nil {
+		cfg = l.cfg.TLS.Clone()
+	}
+	if cfg.ServerName == "" {
+		if u, err := url.Parse(l.cfg.URL); err == nil {
+			cfg.ServerName = u.Hostname()
+		}
+	}
+	return cfg
+}
+
+// search returns the entries under the base DN matching filter, with attributes
+func (l *LDAP) search(ctx context.Context, conn *ldap.Conn, filter string, attributes []string) ([]*ldap.Entry, error) {
+	return l.searchUnder(ctx, conn, l.cfg.BaseDN, ldap.ScopeWholeSubtree, filter, attributes)
+}
+
+// searchUnder returns the entries within scope of base matching filter, with attributes.
+// An object that doesn't exist has no entries rather than failing the search.
+func (l *LDAP) searchUnder(ctx context.Context, conn *ldap.Conn, base string, scope int, filter string, attributes []string) ([]*ldap.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search LDAP server=%s for %s, err=%w", l.cfg.URL, filter, err)
+	}
+	glog.V(4).Infof("Searching LDAP server=%s for %s\n", l.cfg.URL, filter)
+	req := ldap.NewSearchRequest(base, scope, ldap.NeverDerefAliases, 0, 0, false, filter, attributes, nil)
+	res, err := conn.Search(req)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to search LDAP server=%s for %s, err=%w", l.cfg.URL, filter, err)
+	}
+	return res.Entries, nil
+}
+
+// ResolveSlackUser returns the directory user whose mail attribute is the email address of su
+func (l *LDAP) ResolveSlackUser(ctx context.Context, su types.SlackUser) (types.ADUser, error) {
+	if su.Profile.Email == "" {
+		return types.ADUser{}, errNoEmail(su)
+	}
+	conn, closeConn, err := l.connect(ctx)
+	if err != nil {
+		return types.ADUser{}, err
+	}
+	defer closeConn()
+
+	filter := fmt.Sprintf("(&(objectClass=person)(mail=%s))", ldap.EscapeFilter(su.Profile.Email))
+	entries, err := l.search(ctx, conn, filter, userAttributes)
+	if err != nil {
+		return types.ADUser{}, err
+	}
+	if len(entries) != 1 {
+		return types.ADUser{}, fmt.Errorf("expected one directory user with email=%s, found %d", su.Profile.Email, len(entries))
+	}
+	return entryToADUser(entries[0]), nil
+}
+
+// GroupMembers returns the users in the group with common name group and in the groups nested in it.
+// Members are listed by the group's member attribute, and by the memberOf attribute of users and groups, which is
+// all some directories keep and the only place Active Directory shows members added through their primary group.
+// Members that are neither users nor groups are left out.
+func (l *LDAP) GroupMembers(ctx context.Context, group string) ([]types.ADUser, error) {
+	conn, closeConn, err := l.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+	filter := fmt.Sprintf("(&(objectClass=group)(cn=%s))", ldap.EscapeFilter(group))
+	found, err := l.search(ctx, conn, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) != 1 {
+		return nil, fmt.Errorf("expected one directory group named %s, found %d", group, len(found))
+	}
+	return expandGroup(ctx, &ldapGroups{l: l, conn: conn}, found[0].DN)
+}
+
+// ldapGroups lists the members of groups over one connection to the directory server.
+// Groups are known by their DN, since the common names of groups in different OUs may be the same.
+type ldapGroups struct {
+	l    *LDAP
+	conn *ldap.Conn
+}
+
+// memberAttributes are the attributes of the members of groups the provider reads
+var memberAttributes = append([]string{"objectClass"}, userAttributes...)
+
+// directMembers returns the users in the group with the DN group, and the DNs of the groups nested in it
+func (g *ldapGroups) directMembers(ctx context.Context, group string) (users []types.ADUser, groups []string, err error) {
+	found, err := g.l.searchUnder(ctx, g.conn, group, ldap.ScopeBaseObject, "(objectClass=group)", []string{"member"})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(found) != 1 {
+		return nil, nil, fmt.Errorf("there is no directory group %s", group)
+	}
+
+	seen := make(map[string]bool)
+	add := func(e *ldap.Entry) error {
+		key := strings.ToLower(e.DN)
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		if isGroup(e) {
+			groups = append(groups, e.DN)
+			return nil
+		}
+		usr := entryToADUser(e)
+		if !hasIdentifier(usr) {
+			return errNoIdentifier(group, usr)
+		}
+		users = append(users, usr)
+		return nil
+	}
+	for _, dn := range found[0].GetAttributeValues("member") {
+		entries, err := g.l.searchUnder(ctx, g.conn, dn, ldap.ScopeBaseObject, "(|(objectClass=person)(objectClass=group))", memberAttributes)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, e := range entries {
+			if err = add(e); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	filter := fmt.Sprintf("(&(|(objectClass=person)(objectClass=group))(memberOf=%s))", ldap.EscapeFilter(found[0].DN))
+	entries, err := g.l.search(ctx, g.conn, filter, memberAttributes)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if err = add(e); err != nil {
+			return nil, nil, err
+		}
+	}
+	return users, groups, nil
+}
+
+// isGroup reports whether the directory entry e is a group
+func isGroup(e *ldap.Entry) bool {
+	for _, class := range e.GetAttributeValues("objectClass") {
+		if strings.EqualFold(class, "group") {
+			return true
+		}
+	}
+	return false
+}
+
+// entryToADUser converts the directory entry of a user to an ADUser
+func entryToADUser(e *ldap.Entry) types.ADUser {
+	manager, _ := commonName(e.GetAttributeValue("manager"))
+	return types.ADUser{
+		Dn:             e.DN,
+		Cn:             e.GetAttributeValue("cn"),
+		LanID:          e.GetAttributeValue("sAMAccountName"),
+		FirstName:      e.GetAttributeValue("givenName"),
+		LastName:       e.GetAttributeValue("sn"),
+		Email:          e.GetAttributeValue("mail"),
+		Manager:        manager,
+		EmployeeNumber: e.GetAttributeValue("employeeNumber"),
+	}
+}
+
+// commonName returns the value of the leading cn of dn
+func commonName(dn string) (string, error) {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed.RDNs) == 0 {
+		return "", fmt.Errorf("DN %q is empty", dn)
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value, nil
+		}
+	}
+	return "", fmt.Errorf("DN %q doesn't start with a cn", dn)
+}
@@ -0,0 +1,272 @@
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/ldaptest"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewLDAP(t *testing.T) {
+	Convey("NewLDAP should need a server and a base DN", t, func() {
+		_, err := NewLDAP(LDAPConfig{URL: "ldaps://dc.example.com"})
+		So(err, ShouldNotBeNil)
+		_, err = NewLDAP(LDAPConfig{BaseDN: "dc=example,dc=com"})
+		So(err, ShouldNotBeNil)
+		_, err = NewLDAP(LDAPConfig{URL: "ldaps://dc.example.com", BaseDN: "dc=example,dc=com"})
+		So(err, ShouldBeNil)
+		_, err = NewLDAP(LDAPConfig{URL: "ldaps://dc.example.com", BaseDN: "dc=example,dc=com", StartTLS: true})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCommonName(t *testing.T) {
+	Convey("commonName", t, func() {
+		Convey("should return the leading cn, unescaped", func() {
+			cn, err := commonName(`CN=Doe\, John,OU=Users,DC=example,DC=com`)
+			So(err, ShouldBeNil)
+			So(cn, ShouldEqual, "Doe, John")
+		})
+		Convey("should fail for DNs that don't start with a cn", func() {
+			_, err := commonName("OU=Users,DC=example,DC=com")
+			So(err, ShouldNotBeNil)
+			_, err = commonName("")
+			So(err, ShouldNotBeNil)
+			_, err = commonName("not a DN")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEntryToADUser(t *testing.T) {
+	Convey("entryToADUser should map the Active Directory attributes of a user", t, func() {
+		e := ldap.NewEntry(`CN=Doe\, John,OU=Users,DC=example,DC=com`, map[string][]string{
+			"cn":             {"Doe, John"},
+			"sAMAccountName": {"XYZ7"},
+			"givenName":      {"John"},
+			"sn":             {"Doe"},
+			"mail":           {"John.Doe@johndoe.com"},
+			"manager":        {`CN=Q\, Madam,OU=Users,DC=example,DC=com`},
+			"employeeNumber": {"007"},
+		})
+		So(entryToADUser(e), ShouldResemble, types.ADUser{
+			Dn:             `CN=Doe\, John,OU=Users,DC=example,DC=com`,
+			Cn:             "Doe, John",
+			LanID:          "XYZ7",
+			FirstName:      "John",
+			LastName:       "Doe",
+			Email:          "John.Doe@johndoe.com",
+			Manager:        "Q, Madam",
+			EmployeeNumber: "007",
+		})
+	})
+}
+
+const (
+	testBaseDN = "DC=example,DC=com"
+	testBindDN = "CN=svc-bot,OU=Service Accounts,DC=example,DC=com"
+	testTeamDN = "CN=team-42-owners,OU=Groups,DC=example,DC=com"
+)
+
+func newTestDirectory() *ldaptest.Server {
+	srv := ldaptest.NewUnstartedServer()
+	srv.AddBindUser(testBindDN, "s3cret")
+	srv.AddEntry(`CN=Doe\, John,OU=Users,DC=example,DC=com`, map[string][]string{
+		"objectClass":    {"top", "person", "user"},
+		"cn":             {"Doe, John"},
+		"sAMAccountName": {"XYZ7"},
+		"givenName":      {"John"},
+		"sn":             {"Doe"},
+		"mail":           {"John.Doe@johndoe.com"},
+		"employeeNumber": {"007"},
+		"memberOf":       {testTeamDN},
+	})
+	srv.AddEntry(`CN=Roe\, Jane,OU=Users,DC=example,DC=com`, map[string][]string{
+		"objectClass": {"top", "person", "user"},
+		"cn":          {"Roe, Jane"},
+		"mail":        {"jane.roe@johndoe.com"},
+		"memberOf":    {testTeamDN},
+	})
+	srv.AddEntry(`CN=Moe\, Jim,OU=Users,DC=example,DC=com`, map[string][]string{
+		"objectClass": {"top", "person", "user"},
+		"cn":          {"Moe, Jim"},
+		"mail":        {"jim.moe@johndoe.com"},
+	})
+	srv.AddEntry(testTeamDN, map[string][]string{
+		"objectClass": {"top", "group"},
+		"cn":          {"team-42-owners"},
+		"member":      {`CN=Doe\, John,OU=Users,DC=example,DC=com`, `CN=Moe\, Jim,OU=Users,DC=example,DC=com`},
+	})
+	srv.AddEntry("CN=team-43-owners,OU=Groups,DC=example,DC=com", map[string][]string{
+		"objectClass": {"top", "group"},
+		"cn":          {"team-43-owners"},
+		"member":      {testTeamDN, "CN=Gone,OU=Users,DC=example,DC=com", `CN=Doe\, John,OU=Users,DC=example,DC=com`},
+	})
+	srv.AddEntry("CN=team-46-owners,OU=Groups,DC=example,DC=com", map[string][]string{
+		"objectClass": {"top", "group"},
+		"cn":          {"team-46-owners"},
+		"memberOf":    {"CN=team-43-owners,OU=Groups,DC=example,DC=com"},
+		"member":      {`CN=Poe\, Ann,OU=Users,DC=example,DC=com`, "CN=team-43-owners,OU=Groups,DC=example,DC=com"},
+	})
+	srv.AddEntry(`CN=Poe\, Ann,OU=Users,DC=example,DC=com`, map[string][]string{
+		"objectClass": {"top", "person", "user"},
+		"cn":          {"Poe, Ann"},
+		"mail":        {"ann.poe@johndoe.com"},
+	})
+	srv.AddEntry("CN=build-bot,OU=Service Accounts,DC=example,DC=com", map[string][]string{
+		"objectClass": {"top", "person", "user"},
+		"cn":          {"build-bot"},
+		"memberOf":    {"CN=team-44-owners,OU=Groups,DC=example,DC=com"},
+	})
+	srv.AddEntry("CN=team-44-owners,OU=Groups,DC=example,DC=com", map[string][]string{
+		"objectClass": {"top", "group"},
+		"cn":          {"team-44-owners"},
+	})
+	srv.AddEntry("CN=team-47-owners,OU=Groups,DC=example,DC=com", map[string][]string{
+		"objectClass": {"top", "group"},
+		"cn":          {"team-47-owners"},
+		"member":      {"CN=oncall,OU=Groups,DC=example,DC=com"},
+	})
+	srv.AddEntry("CN=oncall,OU=Groups,DC=example,DC=com", map[string][]string{
+		"objectClass": {"top", "group"},
+		"cn":          {"oncall"},
+		"member":      {`CN=Poe\, Ann,OU=Users,DC=example,DC=com`},
+	})
+	srv.AddEntry("CN=oncall,OU=Archive,DC=example,DC=com", map[string][]string{
+		"objectClass": {"top", "group"},
+		"cn":          {"oncall"},
+		"member":      {`CN=Moe\, Jim,OU=Users,DC=example,DC=com`},
+	})
+	return srv
+}
+
+func newTestLDAP(srv *ldaptest.Server, password string) *LDAP {
+	l, err := NewLDAP(LDAPConfig{URL: srv.URL, BindDN: testBindDN, BindPassword: password, BaseDN: testBaseDN, Timeout: 5 * time.Second})
+	So(err, ShouldBeNil)
+	return l
+}
+
+func TestLDAP(t *testing.T) {
+	Convey("LDAP against a directory server", t, func() {
+		srv := newTestDirectory()
+		srv.Start()
+		defer srv.Close()
+		l := newTestLDAP(srv, "s3cret")
+		ctx := context.Background()
+
+		Convey("should resolve Slack users by email address, whatever their Slack name", func() {
+			usr, err := l.ResolveSlackUser(ctx, newTestSlackUser("UJOHN", "Johnny", "D", "john.doe@johndoe.com"))
+			So(err, ShouldBeNil)
+			So(usr.Cn, ShouldEqual, "Doe, John")
+			So(usr.LanID, ShouldEqual, "XYZ7")
+			So(usr.EmployeeNumber, ShouldEqual, "007")
+			So(srv.Binds(), ShouldResemble, []string{testBindDN})
+		})
+		Convey("should fail for Slack users who aren't in the directory", func() {
+			_, err := l.ResolveSlackUser(ctx, newTestSlackUser("UCRAY7Q", "Cray", "Cray", "cray.cray@johndoe.com"))
+			So(err, ShouldNotBeNil)
+			_, err = l.ResolveSlackUser(ctx, newTestSlackUser("UCRAY7Q", "Cray", "Cray", ""))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should list the members of a group and the users that are members of it", func() {
+			members, err := l.GroupMembers(ctx, "team-42-owners")
+			So(err, ShouldBeNil)
+			So(members, ShouldHaveLength, 3)
+			So(members[0].Cn, ShouldEqual, "Doe, John")
+			So(members[0].LanID, ShouldEqual, "XYZ7")
+			So(members[1].Cn, ShouldEqual, "Moe, Jim")
+			So(members[2].Cn, ShouldEqual, "Roe, Jane")
+			So(members[2].Email, ShouldEqual, "jane.roe@johndoe.com")
+			_, err = l.GroupMembers(ctx, "team-45-owners")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should expand the groups nested in a group by member and memberOf, once each", func() {
+			members, err := l.GroupMembers(ctx, "team-43-owners")
+			So(err, ShouldBeNil)
+			var cns []string
+			for _, usr := range members {
+				cns = append(cns, usr.Cn)
+			}
+			So(cns, ShouldResemble, []string{"Doe, John", "Moe, Jim", "Roe, Jane", "Poe, Ann"})
+		})
+		Convey("should expand nested groups by DN, whatever other groups share their name", func() {
+			members, err := l.GroupMembers(ctx, "team-47-owners")
+			So(err, ShouldBeNil)
+			So(members, ShouldHaveLength, 1)
+			So(members[0].Cn, ShouldEqual, "Poe, Ann")
+		})
+		Convey("should fail for groups with members it can't identify", func() {
+			_, err := l.GroupMembers(ctx, "team-44-owners")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail when the service account can't bind", func() {
+			l = newTestLDAP(srv, "guess")
+			_, err := l.GroupMembers(ctx, "team-42-owners")
+			So(err, ShouldNotBeNil)
+			So(srv.Binds(), ShouldBeEmpty)
+		})
+		Convey("should give up once the request context is done", func() {
+			ctx, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err := l.GroupMembers(ctx, "team-42-owners")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLDAPWithTLS(t *testing.T) {
+	Convey("LDAP against a directory server that needs TLS", t, func() {
+		srv := newTestDirectory()
+		su := newTestSlackUser("UJOHN", "John", "Doe", "john.doe@johndoe.com")
+		ctx := context.Background()
+
+		Convey("should search over ldaps:// when it trusts the server", func() {
+			srv.StartTLS()
+			defer srv.Close()
+			l := newTestLDAP(srv, "s3cret")
+			_, err := l.ResolveSlackUser(ctx, su)
+			So(err, ShouldNotBeNil)
+
+			roots := x509.NewCertPool()
+			roots.AddCert(srv.Certificate())
+			l.cfg.TLS = &tls.Config{RootCAs: roots}
+			usr, err := l.ResolveSlackUser(ctx, su)
+			So(err, ShouldBeNil)
+			So(usr.Cn, ShouldEqual, "Doe, John")
+		})
+		Convey("should start TLS on ldap:// connections before binding", func() {
+			srv.Start()
+			defer srv.Close()
+			roots := x509.NewCertPool()
+			roots.AddCert(srv.Certificate())
+			l, err := NewLDAP(LDAPConfig{URL: srv.URL, BindDN: testBindDN, BindPassword: "s3cret", BaseDN: testBaseDN, TLS: &tls.Config{RootCAs: roots}, StartTLS: true})
+			So(err, ShouldBeNil)
+			usr, err := l.ResolveSlackUser(ctx, su)
+			So(err, ShouldBeNil)
+			So(usr.Cn, ShouldEqual, "Doe, John")
+		})
+	})
+}
+
+func TestLDAPSearchCancelled(t *testing.T) {
+	Convey("LDAP searches interrupted by the request context should fail with its error", t, func() {
+		srv := newTestDirectory()
+		srv.Start()
+		defer srv.Close()
+		l := newTestLDAP(srv, "s3cret")
+		ctx, cancel := context.WithCancel(context.Background())
+		conn, closeConn, err := l.connect(ctx)
+		So(err, ShouldBeNil)
+		defer closeConn()
+		cancel()
+		_, err = l.search(ctx, conn, "(objectClass=person)", nil)
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,87 @@
+package identity
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+)
+
+// maxGroupDepth is how many levels of groups nested in a group are expanded.
+// Members of groups nested deeper are left out, like those of groups nested in themselves.
+const maxGroupDepth = 8
+
+// groupLister lists the direct members of directory groups: their users, and the groups nested in them.
+// Groups are known by whatever identifies them to the lister, a name or a DN, compared regardless of case.
+type groupLister interface {
+	directMembers(ctx context.Context, group string) (users []types.ADUser, groups []string, err error)
+}
+
+// expansion expands the groups nested in a group, listing each group once however many groups it is nested in
+type expansion struct {
+	lister groupLister
+	// expanded are the users in each group expanded so far, keyed by the lowercased group
+	expanded map[string][]types.ADUser
+	// expanding are the groups being expanded, the ones a group nested in itself leads back to
+	expanding map[string]bool
+}
+
+// expandGroup returns the users in group and in every group nested in it, as listed by lister
+func expandGroup(ctx context.Context, lister groupLister, group string) ([]types.ADUser, error) {
+	e := &expansion{lister: lister, expanded: make(map[string][]types.ADUser), expanding: make(map[string]bool)}
+	return e.expand(ctx, group, 0)
+}
+
+// expand returns the users in group, which is nested depth groups deep
+func (e *expansion) expand(ctx context.Context, group string, depth int) ([]types.ADUser, error) {
+	key := strings.ToLower(group)
+	if members, ok := e.expanded[key]; ok {
+		return members, nil
+	}
+	if e.expanding[key] {
+		glog.Warningf("Group %s is nested in itself, not expanding it again\n", group)
+		return nil, nil
+	}
+	e.expanding[key] = true
+	defer delete(e.expanding, key)
+
+	users, groups, err := e.lister.directMembers(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	members := addUsers(nil, users)
+	for _, nested := range groups {
+		if depth >= maxGroupDepth {
+			glog.Warningf("Not expanding group %s nested in %s, groups are expanded %d levels deep\n", nested, group, maxGroupDepth)
+			continue
+		}
+		users, err := e.expand(ctx, nested, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		members = addUsers(members, users)
+	}
+	e.expanded[key] = members
+	return members, nil
+}
+
+// addUsers appends the users to members that aren't already in it
+func addUsers(members []types.ADUser, users []types.ADUser) []types.ADUser {
+	for _, usr := range users {
+		if !containsUser(members, usr) {
+			members = append(members, usr)
+		}
+	}
+	return members
+}
+
+// containsUser reports whether usr is one of users
+func containsUser(users []types.ADUser, usr types.ADUser) bool {
+	for _, u := range users {
+		if SameUser(u, usr) {
+			return true
+		}
+	}
+	return false
+}
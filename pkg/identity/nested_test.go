@@ -0,0 +1,80 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeGroups lists the groups it is given, counting how often each is listed
+type fakeGroups struct {
+	users  map[string][]types.ADUser
+	groups map[string][]string
+	listed map[string]int
+}
+
+func (f *fakeGroups) directMembers(ctx context.Context, group string) ([]types.ADUser, []string, error) {
+	f.listed[group]++
+	users, ok := f.users[group]
+	if !ok {
+		return nil, nil, fmt.Errorf("no group %s", group)
+	}
+	return users, f.groups[group], nil
+}
+
+func newTestUser(lanID string) types.ADUser {
+	return types.ADUser{Cn: lanID, LanID: lanID}
+}
+
+func TestExpandGroup(t *testing.T) {
+	Convey("expandGroup", t, func() {
+		f := &fakeGroups{
+			users: map[string][]types.ADUser{
+				"owners":   {newTestUser("A")},
+				"admins":   {newTestUser("B"), newTestUser("A")},
+				"oncall":   {newTestUser("C")},
+				"everyone": {newTestUser("D")},
+			},
+			groups: map[string][]string{
+				"owners": {"admins", "oncall"},
+				"admins": {"oncall"},
+			},
+			listed: make(map[string]int),
+		}
+		ctx := context.Background()
+
+		Convey("should return the users of nested groups once, listing each group once", func() {
+			members, err := expandGroup(ctx, f, "owners")
+			So(err, ShouldBeNil)
+			So(members, ShouldResemble, []types.ADUser{newTestUser("A"), newTestUser("B"), newTestUser("C")})
+			So(f.listed, ShouldResemble, map[string]int{"owners": 1, "admins": 1, "oncall": 1})
+		})
+		Convey("should stop at groups nested in themselves", func() {
+			f.groups["oncall"] = []string{"OWNERS", "everyone"}
+			members, err := expandGroup(ctx, f, "owners")
+			So(err, ShouldBeNil)
+			So(members, ShouldResemble, []types.ADUser{newTestUser("A"), newTestUser("B"), newTestUser("C"), newTestUser("D")})
+			So(f.listed["owners"], ShouldEqual, 1)
+		})
+		Convey("should leave out groups nested too deep", func() {
+			for i := 0; i <= maxGroupDepth; i++ {
+				group := fmt.Sprintf("level-%d", i)
+				f.users[group] = []types.ADUser{newTestUser(group)}
+				f.groups[group] = []string{fmt.Sprintf("level-%d", i+1)}
+			}
+			f.users[fmt.Sprintf("level-%d", maxGroupDepth+1)] = []types.ADUser{newTestUser("too deep")}
+			members, err := expandGroup(ctx, f, "level-0")
+			So(err, ShouldBeNil)
+			So(members, ShouldHaveLength, maxGroupDepth+1)
+			So(containsUser(members, newTestUser("too deep")), ShouldBeFalse)
+		})
+		Convey("should fail when a nested group can't be listed", func() {
+			f.groups["oncall"] = []string{"missing"}
+			_, err := expandGroup(ctx, f, "owners")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ashish-amarnath/slackbots/pkg/httpclient"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+)
+
+// REST is the Provider backed by the AD group and user lookup services.
+// Users are looked up by the "Last, First" common name built from their Slack profile.
+type REST struct {
+	client         *httpclient.Client
+	groupLookupURL string
+	userLookupURL  string
+}
+
+var _ Provider = &REST{}
+
+// NewREST creates a REST provider that looks groups up under groupLookupURL and users under userLookupURL with client
+func NewREST(client *httpclient.Client, groupLookupURL, userLookupURL string) *REST {
+	return &REST{client: client, groupLookupURL: groupLookupURL, userLookupURL: userLookupURL}
+}
+
+func parseADGroupMemberListResp(raw []byte) (respJSON types.ADGroupMemberListResp, err error) {
+	err = json.Unmarshal(raw, &respJSON)
+	return
+}
+
+func parseADUserResp(raw []byte) (respJSON types.ADUser, err error) {
+	err = json.Unmarshal(raw, &respJSON)
+	return
+}
+
+// GroupMembers returns the users in the AD group and in the groups nested in it, looking each of them up by their common name
+func (r *REST) GroupMembers(ctx context.Context, group string) ([]types.ADUser, error) {
+	return expandGroup(ctx, r, group)
+}
+
+// directMembers returns the users in the AD group, and the groups nested in it
+func (r *REST) directMembers(ctx context.Context, group string) (users []types.ADUser, groups []string, err error) {
+	grpURL := fmt.Sprintf("%s/%s", r.groupLookupURL, url.PathEscape(group))
+
+	out, err := r.client.Get(ctx, grpURL, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to look up members of AD group url=%s err=%s", grpURL, err.Error())
+		glog.Error(err)
+		return nil, nil, err
+	}
+	adGrpMemberListResp, err := parseADGroupMemberListResp(out)
+	if err != nil {
+		err = fmt.Errorf("failed to parse members of AD group url=%s err=%s", grpURL, err.Error())
+		glog.Error(err)
+		return nil, nil, err
+	}
+	for _, cn := range adGrpMemberListResp.Members.Users {
+		usr, err := r.getADUserByCN(ctx, cn)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !hasIdentifier(usr) {
+			return nil, nil, errNoIdentifier(group, usr)
+		}
+		users = append(users, usr)
+	}
+	return users, adGrpMemberListResp.Members.Groups, nil
+}
+
+func getADUsrLookupEp(fName, lName, adLookupServerURL string) string {
+	const comma = `%2c`
+	const space = `%20`
+	return fmt.Sprintf("%s/%s%s%s%s", adLookupServerURL, url.PathEscape(lName), comma, space, url.PathEscape(fName))
+}
+
+// getADUser looks up the AD user at url
+func (r *REST) getADUser(ctx context.Context, url string) (usr types.ADUser, err error) {
+	out, err := r.client.Get(ctx, url, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to look up AD user url=%s err=%s", url, err.Error())
+		glog.Error(err)
+		return
+	}
+	usr, err = parseADUserResp(out)
+	if err != nil {
+		err = fmt.Errorf("failed to parse AD user url=%s err=%s", url, err.Error())
+		glog.Error(err)
+	}
+	return
+}
+
+// getADUserByCN looks up the AD user with common name cn, which the lookup service expects as "Last, First"
+func (r *REST) getADUserByCN(ctx context.Context, cn string) (types.ADUser, error) {
+	usr, err := r.getADUser(ctx, fmt.Sprintf("%s/%s", r.userLookupURL, url.PathEscape(cn)))
+	if err != nil {
+		return usr, err
+	}
+	if usr.Cn == "" {
+		usr.Cn = cn
+	}
+	return usr, nil
+}
+
+// ResolveSlackUser looks up the AD user named like su, checking that their email addresses match
+func (r *REST) ResolveSlackUser(ctx context.Context, su types.SlackUser) (usr types.ADUser, err error) {
+	usr, err = r.getADUser(ctx, getADUsrLookupEp(su.Profile.FirstName, su.Profile.LastName, r.userLookupURL))
+	if err != nil {
+		return
+	}
+	if strings.ToLower(usr.Email) != strings.ToLower(su.Profile.Email) {
+		errStr := fmt.Sprintf("AD user's Email=[%s] doesn't match Slack user=[%s]", usr.Email, su.Profile.Email)
+		glog.Error(errStr)
+		err = errors.New(errStr)
+	}
+	return
+}
@@ -0,0 +1,158 @@
+package identity
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/httpclient"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newTestDirectoryServer serves the AD group and user lookups for the group "team 42" and its members John Doe and Jane Roe.
+// The group "team 43" has a member the user lookup knows nothing about, and "team 44" nests "team 42" in itself.
+func newTestDirectoryServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.ToLower(r.URL.EscapedPath()) {
+		case "/groups/team%2042":
+			w.Write([]byte(`{"name":"team 42","members":{"groups":[],"users":["Doe, John","Roe, Jane"]}}`))
+		case "/groups/team%2043":
+			w.Write([]byte(`{"name":"team 43","members":{"groups":[],"users":["Doe, John","Nobody, Known"]}}`))
+		case "/groups/team%2044":
+			w.Write([]byte(`{"name":"team 44","members":{"groups":["team 42","team 44"],"users":["Roe, Jane"]}}`))
+		case "/users/doe%2c%20john":
+			w.Write([]byte(`{"cn":"Doe, John","lanID":"XYZ7","firstName":"John","lastName":"Doe","email":"John.Doe@johndoe.com","employeeNumber":"007"}`))
+		case "/users/roe%2c%20jane":
+			w.Write([]byte(`{"cn":"Roe, Jane","firstName":"Jane","lastName":"Roe","email":"jane.roe@johndoe.com"}`))
+		case "/users/nobody%2c%20known":
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func newTestSlackUser(id, firstName, lastName, email string) types.SlackUser {
+	var usr types.SlackUser
+	usr.ID = id
+	usr.Profile.FirstName = firstName
+	usr.Profile.LastName = lastName
+	usr.Profile.Email = email
+	return usr
+}
+
+func TestParseADGroupMemberListResp(t *testing.T) {
+	Convey("parseADGroupMemberListResp", t, func() {
+		Convey("Should fail when called with invalid JSON bytes", func() {
+			invalidJSON := `{"name":"codeNinjas","description":"super awesome group","email":"codeninjas`
+			_, err := parseADGroupMemberListResp([]byte(invalidJSON))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Should parse a valid JSON string into ADGroupMemberListResp", func() {
+			validJSON := `{"name":"codeNinjas","description":"super awesome group","email":"codeninjas@ninjaing.com","type":"unittest","updated":"2017-08-28T17:24:46.000Z","members":{"groups":[],"users":["ninja1","ninja2","ninja3","ninja4","ninja5"]},"managedBy":{"group":null,"user":"ninjaLeader"},"groups":["Ninja-Team1","Ninja-Team2","Ninja-Team3"]}`
+			actual, err := parseADGroupMemberListResp([]byte(validJSON))
+			So(err, ShouldBeNil)
+			So(actual.Description, ShouldResemble, "super awesome group")
+			So(actual.Name, ShouldResemble, "codeNinjas")
+			So(actual.Email, ShouldResemble, "codeninjas@ninjaing.com")
+			So(actual.Type, ShouldResemble, "unittest")
+			So(strings.Join(actual.Members.Users, ","), ShouldResemble, "ninja1,ninja2,ninja3,ninja4,ninja5")
+		})
+	})
+}
+
+func TestParseADUserResp(t *testing.T) {
+	Convey("parseADUserResp", t, func() {
+		Convey("should parse a valid JSON string to ADUser", func() {
+			validJSON := `{"cn":"Doe, John","lanID":"XYZ7","firstName":"John","lastName":"Doe","email":"John.Doe@johndoe.com","manager":"Q, Madam","employeeNumber":"007"}`
+
+			actual, err := parseADUserResp([]byte(validJSON))
+			So(err, ShouldBeNil)
+			So(actual.Cn, ShouldResemble, "Doe, John")
+			So(actual.LanID, ShouldResemble, "XYZ7")
+			So(actual.FirstName, ShouldResemble, "John")
+			So(actual.LastName, ShouldResemble, "Doe")
+			So(actual.Email, ShouldResemble, "John.Doe@johndoe.com")
+			So(actual.Manager, ShouldResemble, "Q, Madam")
+			So(actual.EmployeeNumber, ShouldResemble, "007")
+		})
+		Convey("should fail when called with invalid JSON string", func() {
+			invalidJSON := `{"cn":"Doe, John","lanID":"XYZ7","firstName":"John","lastName":"Doe","email":"John.Doe@jo`
+			_, err := parseADUserResp([]byte(invalidJSON))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRESTGroupMembers(t *testing.T) {
+	Convey("REST.GroupMembers", t, func() {
+		srv := newTestDirectoryServer()
+		defer srv.Close()
+		r := NewREST(httpclient.Default(), srv.URL+"/groups", srv.URL+"/users")
+
+		Convey("should return the users in the group with their identifiers", func() {
+			actual, err := r.GroupMembers(context.Background(), "team 42")
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, []types.ADUser{
+				{Cn: "Doe, John", LanID: "XYZ7", FirstName: "John", LastName: "Doe", Email: "John.Doe@johndoe.com", EmployeeNumber: "007"},
+				{Cn: "Roe, Jane", FirstName: "Jane", LastName: "Roe", Email: "jane.roe@johndoe.com"},
+			})
+		})
+		Convey("should return the users in the groups nested in the group", func() {
+			actual, err := r.GroupMembers(context.Background(), "team 44")
+			So(err, ShouldBeNil)
+			So(actual, ShouldHaveLength, 2)
+			So(actual[0].Cn, ShouldEqual, "Roe, Jane")
+			So(actual[1].Cn, ShouldEqual, "Doe, John")
+		})
+		Convey("should return with error when a member has no identifiers", func() {
+			actual, err := r.GroupMembers(context.Background(), "team 43")
+			So(actual, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should return with error when unable to get members of an AD group", func() {
+			actual, err := NewREST(httpclient.Default(), "myadserver.foo", "").GroupMembers(context.Background(), "ADMINS")
+			So(actual, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should return with error when the group lookup fails", func() {
+			actual, err := r.GroupMembers(context.Background(), "ADMINS")
+			So(actual, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGetADUsrLookupEp(t *testing.T) {
+	Convey("getADUsrLookupEp should return the correct AD user lookup endpoint", t, func() {
+		expected := `https://adUsrLkp/api/v1/usr/get/doe%2c%20john`
+		actual := getADUsrLookupEp("john", "doe", "https://adUsrLkp/api/v1/usr/get")
+		So(actual, ShouldResemble, expected)
+	})
+}
+
+func TestRESTResolveSlackUser(t *testing.T) {
+	Convey("REST.ResolveSlackUser", t, func() {
+		srv := newTestDirectoryServer()
+		defer srv.Close()
+		r := NewREST(httpclient.Default(), srv.URL+"/groups", srv.URL+"/users")
+
+		Convey("should return the AD user named like the Slack user", func() {
+			actual, err := r.ResolveSlackUser(context.Background(), newTestSlackUser("U1", "John", "Doe", "JOHN.DOE@johndoe.com"))
+			So(err, ShouldBeNil)
+			So(actual.LanID, ShouldEqual, "XYZ7")
+		})
+		Convey("should fail when the email addresses don't match", func() {
+			_, err := r.ResolveSlackUser(context.Background(), newTestSlackUser("U1", "John", "Doe", "john.doe@example.com"))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should return with error when unable to get the requested AD user", func() {
+			r := NewREST(httpclient.Default(), "", "https://adUsrLkp/api/v1/usr/get")
+			_, err := r.ResolveSlackUser(context.Background(), newTestSlackUser("U1", "John", "Doe", "john.doe@johndoe.com"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,107 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// StaticUser is a directory user listed in a static directory file
+type StaticUser struct {
+	// SlackID is the Slack user the directory user is, matched by email address when empty
+	SlackID string `json:"slackID"`
+	types.ADUser
+}
+
+// StaticDirectory is the content of a static directory file
+type StaticDirectory struct {
+	Users []StaticUser `json:"users"`
+	// Groups are the members of each group, keyed by group name. Members are the names of the groups nested in the group,
+	// or the common names of users listed in Users.
+	Groups map[string][]string `json:"groups"`
+}
+
+// Static is the Provider backed by a fixed list of users and groups, for small teams and for trying the bot out
+type Static struct {
+	dir StaticDirectory
+}
+
+var _ Provider = &Static{}
+
+// NewStatic creates a Static provider for dir
+func NewStatic(dir StaticDirectory) *Static {
+	return &Static{dir: dir}
+}
+
+// LoadStatic creates a Static provider for the users and groups in the YAML file at path
+func LoadStatic(path string) (*Static, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static directory=%s, err=%s", path, err.Error())
+	}
+	var dir StaticDirectory
+	if err = yaml.UnmarshalStrict(raw, &dir); err != nil {
+		return nil, fmt.Errorf("failed to parse static directory=%s, err=%s", path, err.Error())
+	}
+	return NewStatic(dir), nil
+}
+
+// ResolveSlackUser returns the user listed with the Slack ID of su, or else with its email address
+func (s *Static) ResolveSlackUser(ctx context.Context, su types.SlackUser) (types.ADUser, error) {
+	for _, usr := range s.dir.Users {
+		if usr.SlackID != "" && usr.SlackID == su.ID {
+			return usr.ADUser, nil
+		}
+	}
+	if su.Profile.Email == "" {
+		return types.ADUser{}, errNoEmail(su)
+	}
+	for _, usr := range s.dir.Users {
+		if usr.SlackID == "" && strings.EqualFold(usr.Email, su.Profile.Email) {
+			return usr.ADUser, nil
+		}
+	}
+	return types.ADUser{}, fmt.Errorf("slack user %s is not in the static directory", su.ID)
+}
+
+// GroupMembers returns the users listed for group and for the groups nested in it
+func (s *Static) GroupMembers(ctx context.Context, group string) ([]types.ADUser, error) {
+	return expandGroup(ctx, s, group)
+}
+
+// directMembers returns the users listed for group by common name, and the groups nested in it
+func (s *Static) directMembers(ctx context.Context, group string) (users []types.ADUser, groups []string, err error) {
+	members, ok := s.dir.Groups[group]
+	if !ok {
+		return nil, nil, fmt.Errorf("group %s is not in the static directory", group)
+	}
+	for _, member := range members {
+		if _, ok := s.dir.Groups[member]; ok {
+			groups = append(groups, member)
+			continue
+		}
+		usr, ok := s.userByCN(member)
+		if !ok {
+			return nil, nil, fmt.Errorf("member %s of group %s is not in the static directory", member, group)
+		}
+		if !hasIdentifier(usr) {
+			return nil, nil, errNoIdentifier(group, usr)
+		}
+		users = append(users, usr)
+	}
+	return users, groups, nil
+}
+
+// userByCN returns the user listed with common name cn
+func (s *Static) userByCN(cn string) (types.ADUser, bool) {
+	for _, usr := range s.dir.Users {
+		if strings.EqualFold(usr.Cn, cn) {
+			return usr.ADUser, true
+		}
+	}
+	return types.ADUser{}, false
+}
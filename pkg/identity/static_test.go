@@ -0,0 +1,100 @@
+package identity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testStaticDirectory = `
+users:
+- cn: Doe, John
+  lanID: XYZ7
+  firstName: John
+  lastName: Doe
+  email: John.Doe@johndoe.com
+  employeeNumber: "007"
+- slackID: UJANE
+  cn: Roe, Jane
+  firstName: Jane
+  lastName: Roe
+  email: jane.roe@johndoe.com
+- cn: Moe, Jim
+  firstName: Jim
+  lastName: Moe
+groups:
+  team-42-owners:
+  - Doe, John
+  - Roe, Jane
+  team-43-owners:
+  - Doe, John
+  - Moe, Jim
+  team-44-owners:
+  - Doe, John
+  - Nobody, Known
+  team-46-owners:
+  - team-42-owners
+  - Doe, John
+`
+
+func TestStatic(t *testing.T) {
+	Convey("Static", t, func() {
+		path := filepath.Join(t.TempDir(), "directory.yaml")
+		So(os.WriteFile(path, []byte(testStaticDirectory), 0600), ShouldBeNil)
+		s, err := LoadStatic(path)
+		So(err, ShouldBeNil)
+		ctx := context.Background()
+
+		Convey("should resolve Slack users by email address, whatever their Slack name", func() {
+			usr, err := s.ResolveSlackUser(ctx, newTestSlackUser("UJOHN", "Johnny", "D", "john.doe@JOHNDOE.com"))
+			So(err, ShouldBeNil)
+			So(usr.Cn, ShouldEqual, "Doe, John")
+			So(usr.EmployeeNumber, ShouldEqual, "007")
+		})
+		Convey("should resolve users listed with a Slack ID by that ID alone", func() {
+			usr, err := s.ResolveSlackUser(ctx, newTestSlackUser("UJANE", "Jane", "Roe", "jane@elsewhere.com"))
+			So(err, ShouldBeNil)
+			So(usr.Cn, ShouldEqual, "Roe, Jane")
+			_, err = s.ResolveSlackUser(ctx, newTestSlackUser("UOTHER", "Jane", "Roe", "jane.roe@johndoe.com"))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail for Slack users who aren't listed", func() {
+			_, err := s.ResolveSlackUser(ctx, newTestSlackUser("UCRAY7Q", "Cray", "Cray", "cray.cray@johndoe.com"))
+			So(err, ShouldNotBeNil)
+			_, err = s.ResolveSlackUser(ctx, newTestSlackUser("UCRAY7Q", "Cray", "Cray", ""))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should list the members of a group with their identifiers", func() {
+			members, err := s.GroupMembers(ctx, "team-42-owners")
+			So(err, ShouldBeNil)
+			So(members, ShouldHaveLength, 2)
+			So(members[0].LanID, ShouldEqual, "XYZ7")
+			So(members[1].Email, ShouldEqual, "jane.roe@johndoe.com")
+			_, err = s.GroupMembers(ctx, "team-45-owners")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should list the members of the groups nested in a group", func() {
+			members, err := s.GroupMembers(ctx, "team-46-owners")
+			So(err, ShouldBeNil)
+			So(members, ShouldHaveLength, 2)
+			So(members[0].Cn, ShouldEqual, "Doe, John")
+			So(members[1].Cn, ShouldEqual, "Roe, Jane")
+		})
+		Convey("should fail for groups with members it can't identify", func() {
+			_, err := s.GroupMembers(ctx, "team-43-owners")
+			So(err, ShouldNotBeNil)
+			_, err = s.GroupMembers(ctx, "team-44-owners")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should refuse directory files it can't load", func() {
+			_, err := LoadStatic(filepath.Join(t.TempDir(), "missing.yaml"))
+			So(err, ShouldNotBeNil)
+			So(os.WriteFile(path, []byte("users:\n- nickname: jd\n"), 0600), ShouldBeNil)
+			_, err = LoadStatic(path)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,226 @@
+// Package k8s reads and patches the namespaces of the clusters in a kubeconfig with the Kubernetes API.
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/retry"
+)
+
+// requestTimeout bounds every call the client makes to a cluster
+const requestTimeout = 30 * time.Second
+
+// NamespaceClient reads and patches namespaces in the clusters named by the contexts of a kubeconfig.
+// Calls give up when their context is done.
+type NamespaceClient interface {
+	GetNamespace(ctx context.Context, cluster, namespace string) (types.KubernetesNamespace, error)
+	// PatchNamespace applies the JSON merge patch to the namespace, leaving the metadata it doesn't mention alone.
+	// Patches that set metadata.resourceVersion fail with a conflict when the namespace has changed since that version.
+	PatchNamespace(ctx context.Context, cluster, namespace string, patch []byte) error
+	ListNamespaces(ctx context.Context, cluster string) (types.KubernetesNamespaceList, error)
+	// Clusters returns the names of the clusters the client knows about, sorted
+	Clusters() ([]string, error)
+}
+
+// Client is a NamespaceClient that talks to each cluster with a clientset built from its kubeconfig context
+type Client struct {
+	newClientset func(cluster string) (kubernetes.Interface, error)
+	clusters     func() ([]string, error)
+
+	lock       sync.Mutex // guards clientsets
+	clientsets map[string]kubernetes.Interface
+}
+
+var _ NamespaceClient = &Client{}
+
+// NewClient creates a Client for the contexts of the kubeconfig at kubeConfig.
+// The kubeconfig is only read when a cluster is first used.
+func NewClient(kubeConfig string) *Client {
+	return &Client{
+		newClientset: func(cluster string) (kubernetes.Interface, error) {
+			return newClusterClientset(kubeConfig, cluster)
+		},
+		clusters: func() ([]string, error) {
+			return kubeConfigContexts(kubeConfig)
+		},
+		clientsets: make(map[string]kubernetes.Interface),
+	}
+}
+
+// NewClientForClientsets creates a Client for the clusters of clientsets, keyed by cluster name.
+// Clusters without a clientset are unknown.
+func NewClientForClientsets(clientsets map[string]kubernetes.Interface) *Client {
+	names := make([]string, 0, len(clientsets))
+	known := make(map[string]kubernetes.Interface, len(clientsets))
+	for cluster, cs := range clientsets {
+		names = append(names, cluster)
+		known[cluster] = cs
+	}
+	sort.Strings(names)
+	return &Client{
+		newClientset: func(cluster string) (kubernetes.Interface, error) {
+			return nil, fmt.Errorf("context %s is not in the kubeconfig", cluster)
+		},
+		clusters: func() ([]string, error) {
+			return names, nil
+		},
+		clientsets: known,
+	}
+}
+
+// kubeConfigContexts returns the names of the contexts in the kubeconfig at kubeConfig
+func kubeConfigContexts(kubeConfig string) ([]string, error) {
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfig}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig=%s, err=%s", kubeConfig, err.Error())
+	}
+	contexts := make([]string, 0, len(cfg.Contexts))
+	for name := range cfg.Contexts {
+		contexts = append(contexts, name)
+	}
+	sort.Strings(contexts)
+	return contexts, nil
+}
+
+// clusterConfig loads the kubeconfig context named cluster, acting as the <cluster>_sudo user
+func clusterConfig(kubeConfig, cluster string) (*rest.Config, error) {
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfig}
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: cluster,
+		Context:        clientcmdapi.Context{AuthInfo: cluster + "_sudo"},
+	}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load context %s from kubeconfig=%s, err=%s", cluster, kubeConfig, err.Error())
+	}
+	cfg.Timeout = requestTimeout
+	return cfg, nil
+}
+
+// newClusterClientset builds a clientset for the kubeconfig context named cluster
+func newClusterClientset(kubeConfig, cluster string) (kubernetes.Interface, error) {
+	cfg, err := clusterConfig(kubeConfig, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+// clientset returns the clientset for cluster, building it the first time the cluster is used
+func (c *Client) clientset(cluster string) (kubernetes.Interface, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cs, ok := c.clientsets[cluster]; ok {
+		return cs, nil
+	}
+	cs, err := c.newClientset(cluster)
+	if err != nil {
+		return nil, err
+	}
+	c.clientsets[cluster] = cs
+	return cs, nil
+}
+
+// GetNamespace fetches the namespace from cluster
+func (c *Client) GetNamespace(ctx context.Context, cluster, namespace string) (ns types.KubernetesNamespace, err error) {
+	cs, err := c.clientset(cluster)
+	if err != nil {
+		return
+	}
+	glog.V(4).Infof("Getting namespace %s in cluster %s\n", namespace, cluster)
+	obj, err := cs.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	return toKubernetesNamespace(obj)
+}
+
+// PatchNamespace applies the JSON merge patch to the namespace in cluster
+func (c *Client) PatchNamespace(ctx context.Context, cluster, namespace string, patch []byte) error {
+	cs, err := c.clientset(cluster)
+	if err != nil {
+		return err
+	}
+	glog.V(4).Infof("Patching namespace %s in cluster %s with %s\n", namespace, cluster, patch)
+	_, err = cs.CoreV1().Namespaces().Patch(ctx, namespace, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// ListNamespaces fetches every namespace in cluster
+func (c *Client) ListNamespaces(ctx context.Context, cluster string) (nsList types.KubernetesNamespaceList, err error) {
+	cs, err := c.clientset(cluster)
+	if err != nil {
+		return
+	}
+	glog.V(4).Infof("Listing namespaces in cluster %s\n", cluster)
+	objs, err := cs.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return
+	}
+	nsList = types.KubernetesNamespaceList{APIVersion: "v1", Kind: "List"}
+	for i := range objs.Items {
+		var ns types.KubernetesNamespace
+		if ns, err = toKubernetesNamespace(&objs.Items[i]); err != nil {
+			return
+		}
+		nsList.Items = append(nsList.Items, ns)
+	}
+	return
+}
+
+// Clusters returns the names of the contexts in the kubeconfig
+func (c *Client) Clusters() ([]string, error) {
+	return c.clusters()
+}
+
+// ValidateNamespaceName returns an error unless name is a valid namespace name, a DNS-1123 label
+func ValidateNamespaceName(name string) error {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return fmt.Errorf("%q is not a valid namespace name, %s", name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// IsConflict reports whether err is the API server refusing a write because the object changed since it was read
+func IsConflict(err error) bool {
+	return apierrors.IsConflict(err)
+}
+
+// RetryOnConflict runs fn, which should read, modify and write an object, until it succeeds without a conflict.
+// It gives up after a few attempts, returning the last conflict.
+func RetryOnConflict(fn func() error) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, fn)
+}
+
+// toKubernetesNamespace converts a namespace returned by the API into the parts of it the bot models
+func toKubernetesNamespace(obj *corev1.Namespace) (ns types.KubernetesNamespace, err error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal namespace %s, err=%s", obj.Name, err.Error())
+		return
+	}
+	if err = json.Unmarshal(raw, &ns); err != nil {
+		err = fmt.Errorf("failed to parse namespace %s, err=%s", obj.Name, err.Error())
+		return
+	}
+	ns.APIVersion, ns.Kind = "v1", "Namespace"
+	return
+}
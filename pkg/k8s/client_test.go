@@ -0,0 +1,50 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClusterConfig(t *testing.T) {
+	Convey("clusterConfig", t, func() {
+		kubeConfig := filepath.Join(t.TempDir(), "kubeconfig")
+		So(os.WriteFile(kubeConfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster1
+  cluster:
+    server: https://cluster1.example.com
+contexts:
+- name: cluster1
+  context:
+    cluster: cluster1
+    user: cluster1
+users:
+- name: cluster1
+  user:
+    token: read-only
+- name: cluster1_sudo
+  user:
+    token: admin
+`), 0600), ShouldBeNil)
+
+		Convey("should load a context in the kubeconfig as its sudo user", func() {
+			cfg, err := clusterConfig(kubeConfig, "cluster1")
+			So(err, ShouldBeNil)
+			So(cfg.Host, ShouldEqual, "https://cluster1.example.com")
+			So(cfg.BearerToken, ShouldEqual, "admin")
+			So(cfg.Timeout, ShouldEqual, requestTimeout)
+		})
+		Convey("should fail for a context that isn't in the kubeconfig", func() {
+			_, err := clusterConfig(kubeConfig, "cluster2")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should fail when the kubeconfig doesn't exist", func() {
+			_, err := clusterConfig(filepath.Join(t.TempDir(), "missing"), "cluster1")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
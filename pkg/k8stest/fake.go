@@ -0,0 +1,86 @@
+// Package k8stest builds k8s clients whose clusters are kept in memory, for tests.
+package k8stest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/ashish-amarnath/slackbots/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// NewClient creates a k8s.Client whose clusters are kept in memory.
+// Each cluster starts with the supplied namespaces, clusters that aren't supplied are unknown.
+func NewClient(clusters map[string][]*corev1.Namespace) *k8s.Client {
+	clientsets := make(map[string]kubernetes.Interface)
+	for cluster, namespaces := range clusters {
+		clientsets[cluster] = NewClientset(namespaces...)
+	}
+	return k8s.NewClientForClientsets(clientsets)
+}
+
+// NewClientset creates a fake clientset of a cluster with the supplied namespaces, whose merge patches of
+// namespaces honor resourceVersions like the API server does
+func NewClientset(namespaces ...*corev1.Namespace) *fake.Clientset {
+	objs := make([]runtime.Object, 0, len(namespaces))
+	for _, ns := range namespaces {
+		ns = ns.DeepCopy()
+		if ns.ResourceVersion == "" {
+			ns.ResourceVersion = "1"
+		}
+		objs = append(objs, ns)
+	}
+	cs := fake.NewClientset(objs...)
+	fakeResourceVersions(cs)
+	return cs
+}
+
+// fakeResourceVersions makes merge patches to the namespaces of cs behave like they do against the API server.
+// Every patch bumps the resourceVersion, and patches naming a resourceVersion other than the current one fail with a conflict.
+func fakeResourceVersions(cs *fake.Clientset) {
+	var lock sync.Mutex
+	version := 1
+	namespaces := corev1.SchemeGroupVersion.WithResource("namespaces")
+	react := k8stesting.ObjectReaction(cs.Tracker())
+	cs.PrependReactor("patch", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction, ok := action.(k8stesting.PatchActionImpl)
+		if !ok || patchAction.GetPatchType() != k8stypes.MergePatchType {
+			return false, nil, nil
+		}
+		lock.Lock()
+		defer lock.Unlock()
+
+		var patch map[string]interface{}
+		if err := json.Unmarshal(patchAction.GetPatch(), &patch); err != nil {
+			return true, nil, apierrors.NewBadRequest(err.Error())
+		}
+		metadata, _ := patch["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = make(map[string]interface{})
+			patch["metadata"] = metadata
+		}
+		obj, err := cs.Tracker().Get(namespaces, "", patchAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		if rv, ok := metadata["resourceVersion"].(string); ok && rv != obj.(*corev1.Namespace).ResourceVersion {
+			return true, nil, apierrors.NewConflict(namespaces.GroupResource(), patchAction.GetName(),
+				fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+		}
+
+		version++
+		metadata["resourceVersion"] = strconv.Itoa(version)
+		if patchAction.Patch, err = json.Marshal(patch); err != nil {
+			return true, nil, err
+		}
+		return react(patchAction)
+	})
+}
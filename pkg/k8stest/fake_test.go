@@ -0,0 +1,101 @@
+package k8stest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/k8s"
+	. "github.com/smartystreets/goconvey/convey"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const allowedRolesAnnotation = "kube2iam.beta.nordstrom.net/allowed-roles"
+
+func newTestNamespace(name, allowedRoles string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"team": "blue"},
+			Annotations: map[string]string{
+				"cloud-team-id":        "42",
+				"slack-channel-users":  "#" + name,
+				allowedRolesAnnotation: allowedRoles,
+			},
+		},
+	}
+}
+
+func TestNewClientset(t *testing.T) {
+	Convey("A Client of fake clientsets", t, func() {
+		cluster1 := NewClientset(newTestNamespace("foo", `["arn:aws:iam::123456789012:role/one"]`), newTestNamespace("bar", ""))
+		c := k8s.NewClientForClientsets(map[string]kubernetes.Interface{
+			"cluster1": cluster1,
+			"cluster2": NewClientset(newTestNamespace("baz", "")),
+		})
+		ctx := context.Background()
+
+		Convey("should get a namespace from its cluster", func() {
+			ns, err := c.GetNamespace(ctx, "cluster1", "foo")
+			So(err, ShouldBeNil)
+			So(ns.APIVersion, ShouldEqual, "v1")
+			So(ns.Kind, ShouldEqual, "Namespace")
+			So(ns.Metadata.Name, ShouldEqual, "foo")
+			So(ns.Metadata.Annotations.CloudTeamID, ShouldEqual, "42")
+			So(ns.Metadata.Annotations.Kube2IamAllowedRoles, ShouldEqual, `["arn:aws:iam::123456789012:role/one"]`)
+
+			_, err = c.GetNamespace(ctx, "cluster2", "foo")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should list the namespaces of a cluster", func() {
+			nsList, err := c.ListNamespaces(ctx, "cluster1")
+			So(err, ShouldBeNil)
+			So(nsList.Items, ShouldHaveLength, 2)
+			names := []string{nsList.Items[0].Metadata.Name, nsList.Items[1].Metadata.Name}
+			So(names, ShouldContain, "foo")
+			So(names, ShouldContain, "bar")
+		})
+		Convey("should patch only the metadata in the patch", func() {
+			err := c.PatchNamespace(ctx, "cluster1", "bar", []byte(`{"metadata":{"annotations":{"kube2iam.beta.nordstrom.net/allowed-roles":"[\"arn:aws:iam::123456789012:role/two\"]"}}}`))
+			So(err, ShouldBeNil)
+
+			obj, err := cluster1.CoreV1().Namespaces().Get(ctx, "bar", metav1.GetOptions{})
+			So(err, ShouldBeNil)
+			So(obj.Labels, ShouldResemble, map[string]string{"team": "blue"})
+			So(obj.Annotations, ShouldResemble, map[string]string{
+				"cloud-team-id":        "42",
+				"slack-channel-users":  "#bar",
+				allowedRolesAnnotation: `["arn:aws:iam::123456789012:role/two"]`,
+			})
+		})
+		Convey("should only apply patches for the current resourceVersion", func() {
+			ns, err := c.GetNamespace(ctx, "cluster1", "bar")
+			So(err, ShouldBeNil)
+			So(ns.Metadata.ResourceVersion, ShouldNotBeEmpty)
+			stale := ns.Metadata.ResourceVersion
+
+			So(c.PatchNamespace(ctx, "cluster1", "bar", []byte(`{"metadata":{"resourceVersion":"`+stale+`","annotations":{"contact-email":"one@example.com"}}}`)), ShouldBeNil)
+			ns, err = c.GetNamespace(ctx, "cluster1", "bar")
+			So(err, ShouldBeNil)
+			So(ns.Metadata.ResourceVersion, ShouldNotEqual, stale)
+			So(ns.Metadata.Annotations.ContactEmail, ShouldEqual, "one@example.com")
+
+			err = c.PatchNamespace(ctx, "cluster1", "bar", []byte(`{"metadata":{"resourceVersion":"`+stale+`","annotations":{"contact-email":"two@example.com"}}}`))
+			So(k8s.IsConflict(err), ShouldBeTrue)
+			ns, err = c.GetNamespace(ctx, "cluster1", "bar")
+			So(err, ShouldBeNil)
+			So(ns.Metadata.Annotations.ContactEmail, ShouldEqual, "one@example.com")
+		})
+		Convey("should fail for namespaces that don't exist", func() {
+			So(c.PatchNamespace(ctx, "cluster1", "baz", []byte(`{}`)), ShouldNotBeNil)
+		})
+		Convey("should fail for clusters that are unknown", func() {
+			_, err := c.GetNamespace(ctx, "cluster3", "foo")
+			So(err, ShouldNotBeNil)
+			_, err = c.ListNamespaces(ctx, "cluster3")
+			So(err, ShouldNotBeNil)
+			So(c.PatchNamespace(ctx, "cluster3", "foo", []byte(`{}`)), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,95 @@
+// Package kube2iam models the kube2iam annotations the bot manages on namespaces.
+package kube2iam
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AllowedRolesAnnotation is the namespace annotation listing the roles pods in the namespace may assume
+const AllowedRolesAnnotation = "kube2iam.beta.nordstrom.net/allowed-roles"
+
+// AllowedRoles represents the value of the allowed roles annotation, a JSON array of role ARNs.
+// Roles keep the order they were added in so the annotation only changes where a role was added or removed.
+// The zero value allows no roles.
+type AllowedRoles struct {
+	arns []string
+}
+
+// NormalizeRoleArn returns arn without the whitespace and quotes hand edited annotations tend to accumulate
+func NormalizeRoleArn(arn string) string {
+	return strings.TrimSpace(strings.Trim(strings.TrimSpace(arn), `"'`))
+}
+
+// ParseAllowedRoles parses the value of the allowed roles annotation, dropping empty and duplicate ARNs.
+// A missing annotation allows no roles, anything other than a JSON array of strings is an error.
+func ParseAllowedRoles(annotation string) (roles AllowedRoles, err error) {
+	annotation = strings.TrimSpace(annotation)
+	if annotation == "" {
+		return
+	}
+	var arns []string
+	if err = json.Unmarshal([]byte(annotation), &arns); err != nil {
+		err = fmt.Errorf("malformed allowed roles annotation %s, expected a JSON array of role ARNs, err=%s", annotation, err.Error())
+		return
+	}
+	for _, arn := range arns {
+		roles.Add(arn)
+	}
+	return
+}
+
+func (r AllowedRoles) indexOf(arn string) int {
+	arn = NormalizeRoleArn(arn)
+	for i, allowed := range r.arns {
+		if allowed == arn {
+			return i
+		}
+	}
+	return -1
+}
+
+// Contains reports whether arn is allowed
+func (r AllowedRoles) Contains(arn string) bool {
+	return r.indexOf(arn) >= 0
+}
+
+// Add allows arn, reporting whether it wasn't allowed already
+func (r *AllowedRoles) Add(arn string) bool {
+	arn = NormalizeRoleArn(arn)
+	if arn == "" || r.Contains(arn) {
+		return false
+	}
+	r.arns = append(r.arns, arn)
+	return true
+}
+
+// Remove disallows arn, reporting whether it was allowed
+func (r *AllowedRoles) Remove(arn string) bool {
+	i := r.indexOf(arn)
+	if i < 0 {
+		return false
+	}
+	r.arns = append(r.arns[:i:i], r.arns[i+1:]...)
+	return true
+}
+
+// List returns the allowed role ARNs
+func (r AllowedRoles) List() []string {
+	return append([]string(nil), r.arns...)
+}
+
+// Len returns the number of allowed roles
+func (r AllowedRoles) Len() int {
+	return len(r.arns)
+}
+
+// String returns the value of the allowed roles annotation, a compact JSON array
+func (r AllowedRoles) String() string {
+	if len(r.arns) == 0 {
+		return "[]"
+	}
+	raw, _ := json.Marshal(r.arns)
+	return string(raw)
+}
@@ -0,0 +1,84 @@
+package kube2iam
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseAllowedRoles(t *testing.T) {
+	Convey("ParseAllowedRoles", t, func() {
+		Convey("should parse a JSON array of role ARNs", func() {
+			actual, err := ParseAllowedRoles(`["arn:aws:iam::123456789012:role/one","arn:aws:iam::123456789012:role/two"]`)
+			So(err, ShouldBeNil)
+			So(actual.List(), ShouldResemble, []string{"arn:aws:iam::123456789012:role/one", "arn:aws:iam::123456789012:role/two"})
+		})
+		Convey("should allow no roles for a missing or empty annotation", func() {
+			for _, annotation := range []string{"", "  \n", "[]", "[ ]\n"} {
+				actual, err := ParseAllowedRoles(annotation)
+				So(err, ShouldBeNil)
+				So(actual.Len(), ShouldEqual, 0)
+				So(actual.String(), ShouldEqual, "[]")
+			}
+		})
+		Convey("should normalize whitespace and drop empty and duplicate ARNs", func() {
+			actual, err := ParseAllowedRoles("[\n  \" arn:aws:iam::123456789012:role/one \",\n  \"\",\n  \"arn:aws:iam::123456789012:role/one\",\n  \"arn:aws:iam::123456789012:role/two\"\n]\n")
+			So(err, ShouldBeNil)
+			So(actual.String(), ShouldEqual, `["arn:aws:iam::123456789012:role/one","arn:aws:iam::123456789012:role/two"]`)
+		})
+		Convey("should keep ARNs with commas and escaped quotes intact", func() {
+			actual, err := ParseAllowedRoles(`["arn:aws:iam::123456789012:role/team,ops","arn:aws:iam::123456789012:role/say\"hi\"x"]`)
+			So(err, ShouldBeNil)
+			So(actual.Len(), ShouldEqual, 2)
+			So(actual.Contains("arn:aws:iam::123456789012:role/team,ops"), ShouldBeTrue)
+			So(actual.Contains(`arn:aws:iam::123456789012:role/say"hi"x`), ShouldBeTrue)
+		})
+		Convey("should fail on malformed annotations", func() {
+			for _, annotation := range []string{
+				`["arn:aws:iam::123456789012:role/one"`,
+				`arn:aws:iam::123456789012:role/one`,
+				`"arn:aws:iam::123456789012:role/one"`,
+				`{"roles":["arn:aws:iam::123456789012:role/one"]}`,
+				`[1,2]`,
+				`["arn:aws:iam::123456789012:role/one",]`,
+			} {
+				_, err := ParseAllowedRoles(annotation)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestAllowedRoles(t *testing.T) {
+	Convey("AllowedRoles", t, func() {
+		var roles AllowedRoles
+
+		Convey("should add roles once, in the order they were added", func() {
+			So(roles.Add("arn:aws:iam::123456789012:role/two"), ShouldBeTrue)
+			So(roles.Add("arn:aws:iam::123456789012:role/one"), ShouldBeTrue)
+			So(roles.Add(" arn:aws:iam::123456789012:role/two\n"), ShouldBeFalse)
+			So(roles.Add("  "), ShouldBeFalse)
+			So(roles.String(), ShouldEqual, `["arn:aws:iam::123456789012:role/two","arn:aws:iam::123456789012:role/one"]`)
+		})
+		Convey("should remove allowed roles only", func() {
+			roles.Add("arn:aws:iam::123456789012:role/one")
+			roles.Add("arn:aws:iam::123456789012:role/two")
+			roles.Add("arn:aws:iam::123456789012:role/three")
+			list := roles.List()
+			So(roles.Remove("arn:aws:iam::123456789012:role/two"), ShouldBeTrue)
+			So(roles.Remove("arn:aws:iam::123456789012:role/two"), ShouldBeFalse)
+			So(roles.Contains("arn:aws:iam::123456789012:role/two"), ShouldBeFalse)
+			So(roles.String(), ShouldEqual, `["arn:aws:iam::123456789012:role/one","arn:aws:iam::123456789012:role/three"]`)
+			So(list, ShouldHaveLength, 3)
+		})
+		Convey("should serialize the same roles the same way every time", func() {
+			parsed, err := ParseAllowedRoles(roles.String())
+			So(err, ShouldBeNil)
+			So(parsed.String(), ShouldEqual, "[]")
+			roles.Add("arn:aws:iam::123456789012:role/one")
+			parsed, err = ParseAllowedRoles(roles.String())
+			So(err, ShouldBeNil)
+			So(parsed.String(), ShouldEqual, roles.String())
+		})
+	})
+}
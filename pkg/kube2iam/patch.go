@@ -0,0 +1,15 @@
+package kube2iam
+
+import "encoding/json"
+
+// AnnotationPatch returns a JSON merge patch that sets a single namespace annotation and leaves the rest of the metadata alone.
+// When resourceVersion isn't empty the patch only applies to that version of the namespace.
+func AnnotationPatch(annotation, value, resourceVersion string) ([]byte, error) {
+	metadata := map[string]interface{}{
+		"annotations": map[string]string{annotation: value},
+	}
+	if resourceVersion != "" {
+		metadata["resourceVersion"] = resourceVersion
+	}
+	return json.Marshal(map[string]interface{}{"metadata": metadata})
+}
@@ -0,0 +1,72 @@
+package kube2iam
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAnnotationPatch(t *testing.T) {
+	Convey("AnnotationPatch", t, func() {
+		Convey("should only set the supplied annotation", func() {
+			raw, err := AnnotationPatch(AllowedRolesAnnotation, `["arn:aws:iam::123456789012:role/one"]`, "")
+			So(err, ShouldBeNil)
+			So(string(raw), ShouldEqual, `{"metadata":{"annotations":{"kube2iam.beta.nordstrom.net/allowed-roles":"[\"arn:aws:iam::123456789012:role/one\"]"}}}`)
+
+			var patch map[string]map[string]map[string]string
+			So(json.Unmarshal(raw, &patch), ShouldBeNil)
+			So(patch, ShouldHaveLength, 1)
+			So(patch["metadata"], ShouldHaveLength, 1)
+			So(patch["metadata"]["annotations"], ShouldHaveLength, 1)
+		})
+		Convey("should keep the labels and annotations it doesn't mention when merged into a namespace", func() {
+			ns := map[string]interface{}{}
+			So(json.Unmarshal([]byte(`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"ns1","labels":{"team":"blue"},"annotations":{"cloud-team-id":"42","slack-channel-users":"U1,U2","kube2iam.beta.nordstrom.net/allowed-roles":"[]"}}}`), &ns), ShouldBeNil)
+
+			raw, err := AnnotationPatch(AllowedRolesAnnotation, `["arn:aws:iam::123456789012:role/one"]`, "")
+			So(err, ShouldBeNil)
+			patch := map[string]interface{}{}
+			So(json.Unmarshal(raw, &patch), ShouldBeNil)
+			mergePatch(ns, patch)
+
+			metadata := ns["metadata"].(map[string]interface{})
+			So(metadata["name"], ShouldEqual, "ns1")
+			So(metadata["labels"], ShouldResemble, map[string]interface{}{"team": "blue"})
+			So(metadata["annotations"], ShouldResemble, map[string]interface{}{
+				"cloud-team-id":        "42",
+				"slack-channel-users":  "U1,U2",
+				AllowedRolesAnnotation: `["arn:aws:iam::123456789012:role/one"]`,
+			})
+		})
+		Convey("should only apply to the resourceVersion it was given", func() {
+			raw, err := AnnotationPatch(AllowedRolesAnnotation, "[]", "193695467")
+			So(err, ShouldBeNil)
+			So(string(raw), ShouldEqual, `{"metadata":{"annotations":{"kube2iam.beta.nordstrom.net/allowed-roles":"[]"},"resourceVersion":"193695467"}}`)
+		})
+		Convey("should clear the roles without removing the annotation", func() {
+			raw, err := AnnotationPatch(AllowedRolesAnnotation, "[]", "")
+			So(err, ShouldBeNil)
+			So(string(raw), ShouldEqual, `{"metadata":{"annotations":{"kube2iam.beta.nordstrom.net/allowed-roles":"[]"}}}`)
+		})
+	})
+}
+
+// mergePatch merges patch into doc the way the API server applies a JSON merge patch
+func mergePatch(doc, patch map[string]interface{}) {
+	for k, v := range patch {
+		switch pv := v.(type) {
+		case nil:
+			delete(doc, k)
+		case map[string]interface{}:
+			dv, ok := doc[k].(map[string]interface{})
+			if !ok {
+				dv = map[string]interface{}{}
+				doc[k] = dv
+			}
+			mergePatch(dv, pv)
+		default:
+			doc[k] = v
+		}
+	}
+}
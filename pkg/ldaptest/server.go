@@ -0,0 +1,414 @@
+// Package ldaptest provides an in-process LDAP server holding a fixed directory, for tests of LDAP clients.
+// It speaks just enough of the protocol for them: simple binds, searches, StartTLS and unbinds.
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang/glog"
+)
+
+// startTLSOID names the StartTLS extended operation
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// Entry is an object in the directory, with values for each of its attributes
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Server is a fake LDAP directory server listening on a local port.
+// Searches need a successful bind when the server has bind users, like a directory that doesn't allow anonymous access.
+type Server struct {
+	// URL is the ldap:// or ldaps:// URL of the server, set once it is started
+	URL string
+	// TLS is the configuration of ldaps:// and StartTLS connections, a self-signed certificate for 127.0.0.1 when nil
+	TLS *tls.Config
+
+	listener net.Listener
+	wg       sync.WaitGroup
+	lock     sync.Mutex // guards entries, passwords, binds and conns
+	entries  []Entry
+	// passwords are the passwords of the bind users, keyed by DN
+	passwords map[string]string
+	binds     []string
+	conns     map[net.Conn]bool
+}
+
+// NewUnstartedServer returns a Server that isn't listening yet, for its TLS to be configured before it starts
+func NewUnstartedServer() *Server {
+	return &Server{
+		passwords: make(map[string]string),
+		conns:     make(map[net.Conn]bool),
+	}
+}
+
+// NewServer starts a Server for ldap:// connections
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// Start starts the server for ldap:// connections, which may be upgraded with StartTLS
+func (s *Server) Start() {
+	s.initTLS()
+	s.serve(s.listen(), "ldap")
+}
+
+// StartTLS starts the server for ldaps:// connections
+func (s *Server) StartTLS() {
+	s.initTLS()
+	s.serve(tls.NewListener(s.listen(), s.TLS), "ldaps")
+}
+
+// Certificate returns the certificate the server presents, for clients to trust
+func (s *Server) Certificate() *x509.Certificate {
+	return s.TLS.Certificates[0].Leaf
+}
+
+// AddEntry adds the object dn, with attrs, to the directory
+func (s *Server) AddEntry(dn string, attrs map[string][]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries = append(s.entries, Entry{DN: dn, Attributes: attrs})
+}
+
+// AddBindUser lets clients bind as dn with password
+func (s *Server) AddBindUser(dn, password string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.passwords[dn] = password
+}
+
+// Binds returns the DNs clients successfully bound as, in the order they bound
+func (s *Server) Binds() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string{}, s.binds...)
+}
+
+// Close stops the server and closes every connection to it
+func (s *Server) Close() {
+	s.listener.Close()
+	s.lock.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) listen() net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("ldaptest: failed to listen on a local port: %v", err))
+	}
+	return l
+}
+
+func (s *Server) serve(l net.Listener, scheme string) {
+	s.listener = l
+	s.URL = fmt.Sprintf("%s://%s", scheme, l.Addr().String())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.lock.Lock()
+			s.conns[conn] = true
+			s.lock.Unlock()
+			s.wg.Add(1)
+			go s.handleConn(conn)
+		}
+	}()
+}
+
+// initTLS generates a self-signed certificate for 127.0.0.1 unless TLS is configured
+func (s *Server) initTLS() {
+	if s.TLS != nil {
+		return
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("ldaptest: failed to generate a key: %v", err))
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldaptest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("ldaptest: failed to create a certificate: %v", err))
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(fmt.Sprintf("ldaptest: failed to parse the certificate: %v", err))
+	}
+	s.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}}}
+}
+
+// handleConn answers the requests read from conn until the client unbinds or goes away
+func (s *Server) handleConn(raw net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, raw)
+		s.lock.Unlock()
+		raw.Close()
+	}()
+
+	// conn is replaced by its TLS wrapper when the client starts TLS
+	conn := raw
+
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			if err != io.EOF {
+				glog.V(4).Infof("ldaptest: failed to read request, err=%s\n", err.Error())
+			}
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		msgID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := s.bind(op)
+			bound = code == ldap.LDAPResultSuccess
+			if err = writeResult(conn, msgID, ldap.ApplicationBindResponse, code); err != nil {
+				return
+			}
+		case ldap.ApplicationSearchRequest:
+			if err = s.search(conn, msgID, op, bound); err != nil {
+				return
+			}
+		case ldap.ApplicationExtendedRequest:
+			if len(op.Children) == 0 || op.Children[0].Data.String() != startTLSOID {
+				if err = writeResult(conn, msgID, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError); err != nil {
+					return
+				}
+				continue
+			}
+			if err = writeResult(conn, msgID, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess); err != nil {
+				return
+			}
+			tlsConn := tls.Server(conn, s.TLS)
+			if err = tlsConn.Handshake(); err != nil {
+				glog.V(4).Infof("ldaptest: StartTLS handshake failed, err=%s\n", err.Error())
+				return
+			}
+			conn = tlsConn
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			if err = writeResult(conn, msgID, ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind checks the credentials of a simple bind request, returning its result code
+func (s *Server) bind(op *ber.Packet) uint16 {
+	if len(op.Children) < 3 || op.Children[2].Tag != 0 {
+		return ldap.LDAPResultAuthMethodNotSupported
+	}
+	dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if dn == "" && password == "" && len(s.passwords) == 0 {
+		return ldap.LDAPResultSuccess
+	}
+	if want, ok := s.passwords[dn]; !ok || password == "" || password != want {
+		return ldap.LDAPResultInvalidCredentials
+	}
+	s.binds = append(s.binds, dn)
+	return ldap.LDAPResultSuccess
+}
+
+// search writes the entries matching a search request to w, followed by the result
+func (s *Server) search(w io.Writer, msgID int64, op *ber.Packet, bound bool) error {
+	if len(op.Children) < 8 {
+		return writeResult(w, msgID, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)
+	}
+	s.lock.Lock()
+	needsBind := len(s.passwords) > 0
+	entries := append([]Entry{}, s.entries...)
+	s.lock.Unlock()
+	if needsBind && !bound {
+		return writeResult(w, msgID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+	}
+
+	base, err := ldap.ParseDN(op.Children[0].Data.String())
+	if err != nil {
+		return writeResult(w, msgID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInvalidDNSyntax)
+	}
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var attributes []string
+	for _, attr := range op.Children[7].Children {
+		attributes = append(attributes, attr.Data.String())
+	}
+
+	for _, e := range entries {
+		dn, err := ldap.ParseDN(e.DN)
+		if err != nil || !inScope(base, dn, scope) {
+			continue
+		}
+		ok, err := matches(e, filter)
+		if err != nil {
+			return writeResult(w, msgID, ldap.ApplicationSearchResultDone, ldap.LDAPResultUnwillingToPerform)
+		}
+		if !ok {
+			continue
+		}
+		if _, err = w.Write(envelope(msgID, entryPacket(e, attributes)).Bytes()); err != nil {
+			return err
+		}
+	}
+	return writeResult(w, msgID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+}
+
+// inScope reports whether dn is within scope of base
+func inScope(base, dn *ldap.DN, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return base.EqualFold(dn)
+	case ldap.ScopeSingleLevel:
+		return base.AncestorOfFold(dn) && len(dn.RDNs) == len(base.RDNs)+1
+	default:
+		return base.EqualFold(dn) || base.AncestorOfFold(dn)
+	}
+}
+
+// values returns the values of the attribute of e named, case insensitively, attr
+func values(e Entry, attr string) []string {
+	for name, vals := range e.Attributes {
+		if strings.EqualFold(name, attr) {
+			return vals
+		}
+	}
+	return nil
+}
+
+// matches reports whether e matches filter, comparing values case insensitively like most Active Directory attributes
+func matches(e Entry, filter *ber.Packet) (bool, error) {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, f := range filter.Children {
+			if ok, err := matches(e, f); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, f := range filter.Children {
+			if ok, err := matches(e, f); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		if len(filter.Children) != 1 {
+			return false, fmt.Errorf("not filter with %d children", len(filter.Children))
+		}
+		ok, err := matches(e, filter.Children[0])
+		return !ok, err
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false, fmt.Errorf("equality filter with %d children", len(filter.Children))
+		}
+		want := filter.Children[1].Data.String()
+		for _, v := range values(e, filter.Children[0].Data.String()) {
+			if strings.EqualFold(v, want) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterPresent:
+		return len(values(e, filter.Data.String())) > 0, nil
+	default:
+		return false, fmt.Errorf("unsupported filter %s", ldap.FilterMap[uint64(filter.Tag)])
+	}
+}
+
+// entryPacket encodes e as a search result entry with the attributes requested, all of them when none are
+func entryPacket(e Entry, attributes []string) *ber.Packet {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "Object Name"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, vals := range e.Attributes {
+		if !requested(name, attributes) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	entry.AppendChild(attrs)
+	return entry
+}
+
+// requested reports whether the attribute name is in attributes, or attributes asks for all of them
+func requested(name string, attributes []string) bool {
+	if len(attributes) == 0 {
+		return true
+	}
+	for _, a := range attributes {
+		if a == "*" || strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// envelope wraps the protocol operation op in an LDAP message with msgID
+func envelope(msgID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+// writeResult writes the response of type tag with result code to w
+func writeResult(w io.Writer, msgID int64, tag ber.Tag, code uint16) error {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ldap.LDAPResultCodeMap[code], "Diagnostic Message"))
+	_, err := w.Write(envelope(msgID, op).Bytes())
+	return err
+}
@@ -0,0 +1,127 @@
+package ldaptest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testBindDN = "CN=svc-bot,OU=Service Accounts,DC=example,DC=com"
+
+func newTestServer() *Server {
+	srv := NewUnstartedServer()
+	srv.AddBindUser(testBindDN, "s3cret")
+	srv.AddEntry(`CN=Doe\, John,OU=Users,DC=example,DC=com`, map[string][]string{
+		"objectClass": {"top", "person"},
+		"cn":          {"Doe, John"},
+		"mail":        {"John.Doe@johndoe.com"},
+	})
+	srv.AddEntry(`CN=Roe\, Jane,OU=Users,DC=example,DC=com`, map[string][]string{
+		"objectClass": {"top", "person"},
+		"cn":          {"Roe, Jane"},
+		"mail":        {"jane.roe@johndoe.com"},
+	})
+	srv.AddEntry("CN=Contractors,OU=Users,DC=other,DC=com", map[string][]string{
+		"objectClass": {"top", "person"},
+		"cn":          {"Contractors"},
+	})
+	return srv
+}
+
+func search(conn *ldap.Conn, filter string, attributes ...string) ([]*ldap.Entry, error) {
+	res, err := conn.Search(ldap.NewSearchRequest("DC=example,DC=com", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, filter, attributes, nil))
+	if err != nil {
+		return nil, err
+	}
+	return res.Entries, nil
+}
+
+func TestServer(t *testing.T) {
+	Convey("A client of the fake directory", t, func() {
+		srv := newTestServer()
+		srv.Start()
+		defer srv.Close()
+		conn, err := ldap.DialURL(srv.URL)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("should need to bind before searching", func() {
+			_, err := search(conn, "(objectClass=person)")
+			So(ldap.IsErrorWithCode(err, ldap.LDAPResultInsufficientAccessRights), ShouldBeTrue)
+		})
+		Convey("should fail to bind with the wrong password", func() {
+			err := conn.Bind(testBindDN, "guess")
+			So(ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials), ShouldBeTrue)
+			So(srv.Binds(), ShouldBeEmpty)
+		})
+		Convey("once bound", func() {
+			So(conn.Bind(testBindDN, "s3cret"), ShouldBeNil)
+			So(srv.Binds(), ShouldResemble, []string{testBindDN})
+
+			Convey("should find entries under the base DN, ignoring case", func() {
+				entries, err := search(conn, "(&(objectClass=PERSON)(mail=john.doe@johndoe.com))", "cn")
+				So(err, ShouldBeNil)
+				So(entries, ShouldHaveLength, 1)
+				So(entries[0].DN, ShouldEqual, `CN=Doe\, John,OU=Users,DC=example,DC=com`)
+				So(entries[0].GetAttributeValue("cn"), ShouldEqual, "Doe, John")
+				So(entries[0].GetAttributeValue("mail"), ShouldEqual, "")
+
+				entries, err = search(conn, "(objectClass=person)")
+				So(err, ShouldBeNil)
+				So(entries, ShouldHaveLength, 2)
+			})
+			Convey("should support or, not and presence filters", func() {
+				entries, err := search(conn, "(|(mail=nobody@johndoe.com)(!(cn=Doe, John)))")
+				So(err, ShouldBeNil)
+				So(entries, ShouldHaveLength, 1)
+				So(entries[0].GetAttributeValue("cn"), ShouldEqual, "Roe, Jane")
+
+				entries, err = search(conn, "(&(objectClass=person)(!(mail=*)))")
+				So(err, ShouldBeNil)
+				So(entries, ShouldBeEmpty)
+			})
+			Convey("should refuse filters it doesn't support", func() {
+				_, err := search(conn, "(cn=Doe*)")
+				So(ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestServerWithTLS(t *testing.T) {
+	Convey("The fake directory", t, func() {
+		srv := newTestServer()
+		roots := x509.NewCertPool()
+
+		Convey("should serve ldaps:// with its own certificate", func() {
+			srv.StartTLS()
+			defer srv.Close()
+			roots.AddCert(srv.Certificate())
+
+			_, err := ldap.DialURL(srv.URL, ldap.DialWithTLSConfig(&tls.Config{ServerName: "127.0.0.1"}))
+			So(err, ShouldNotBeNil)
+
+			conn, err := ldap.DialURL(srv.URL, ldap.DialWithTLSConfig(&tls.Config{ServerName: "127.0.0.1", RootCAs: roots}))
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			So(conn.Bind(testBindDN, "s3cret"), ShouldBeNil)
+		})
+		Convey("should upgrade ldap:// connections with StartTLS", func() {
+			srv.Start()
+			defer srv.Close()
+			roots.AddCert(srv.Certificate())
+
+			conn, err := ldap.DialURL(srv.URL)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			So(conn.StartTLS(&tls.Config{ServerName: "127.0.0.1", RootCAs: roots}), ShouldBeNil)
+			So(conn.Bind(testBindDN, "s3cret"), ShouldBeNil)
+			entries, err := search(conn, "(cn=Roe, Jane)")
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 1)
+		})
+	})
+}
@@ -0,0 +1,291 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+)
+
+const (
+	slackSignatureHeader = "X-Slack-Signature"
+	slackTimestampHeader = "X-Slack-Request-Timestamp"
+	slackSignatureVer    = "v0"
+	// maxRequestAge is how old a signed request may be before it is rejected as a replay
+	maxRequestAge = 5 * time.Minute
+	// maxEventBodyBytes bounds the size of an event callback read into memory
+	maxEventBodyBytes = 1 << 20
+	// enqueueTimeout bounds how long a callback waits for the bot to pick up the message before slack retries
+	enqueueTimeout = 2 * time.Second
+)
+
+// EventsServer receives slack Events API callbacks over HTTP and replies with the Web API
+type EventsServer struct {
+	UserID string
+	WebClient
+
+	signingSecret string
+	botToken      string
+	server        *http.Server
+	messages      chan types.Message
+	interactions  chan types.InteractionCallback
+	done          chan struct{}
+	closeOnce     sync.Once
+	now           func() time.Time
+
+	seenLock sync.Mutex // guards seen
+	seen     map[string]time.Time
+}
+
+func newEventsServer(signingSecret, botToken, userID string) *EventsServer {
+	return &EventsServer{
+		UserID:        userID,
+		WebClient:     WebClient{token: botToken},
+		signingSecret: signingSecret,
+		botToken:      botToken,
+		messages:      make(chan types.Message, 64),
+		interactions:  make(chan types.InteractionCallback, 16),
+		done:          make(chan struct{}),
+		now:           time.Now,
+		seen:          make(map[string]time.Time),
+	}
+}
+
+// NewEventsServer starts an HTTP server on listenAddr that accepts Events API callbacks signed with signingSecret.
+// Interactive payloads, e.g. button clicks, are accepted on the same address.
+func NewEventsServer(listenAddr, signingSecret, botToken string) (*EventsServer, error) {
+	if signingSecret == "" || botToken == "" {
+		return nil, fmt.Errorf("expected non-empty slack signing secret and bot token for the events transport")
+	}
+	userID, err := authTest(botToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to identify slack bot user, err=%s", err.Error())
+	}
+	if err = loadSlackUsers(botToken); err != nil {
+		return nil, fmt.Errorf("failed to load slack users, err=%s", err.Error())
+	}
+
+	s := newEventsServer(signingSecret, botToken, userID)
+	s.server = &http.Server{
+		Addr:         listenAddr,
+		Handler:      s,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	go func() {
+		glog.V(1).Infof("Listening for slack events on %s\n", listenAddr)
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("Slack events server on %s failed. err=%s\n", listenAddr, err.Error())
+			s.Close()
+		}
+	}()
+	return s, nil
+}
+
+// verifySignature checks that body was signed by slack with secret no longer than maxRequestAge before now
+func verifySignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request timestamp [%s]", timestamp)
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > maxRequestAge || age < -maxRequestAge {
+		return fmt.Errorf("request timestamp [%s] is outside the allowed window of %s", timestamp, maxRequestAge)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%s:", slackSignatureVer, timestamp)
+	mac.Write(body)
+	expected := slackSignatureVer + "=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("request signature mismatch")
+	}
+	return nil
+}
+
+// isDuplicate reports whether the event was already received, e.g. when slack retries a slow callback
+func (s *EventsServer) isDuplicate(eventID string) bool {
+	if eventID == "" {
+		return false
+	}
+	now := s.now()
+	s.seenLock.Lock()
+	defer s.seenLock.Unlock()
+	for id, t := range s.seen {
+		if now.Sub(t) > time.Hour {
+			delete(s.seen, id)
+		}
+	}
+	if _, ok := s.seen[eventID]; ok {
+		return true
+	}
+	s.seen[eventID] = now
+	return false
+}
+
+// ServeHTTP handles a single Events API callback or interactive payload
+func (s *EventsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEventBodyBytes))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	err = verifySignature(s.signingSecret, r.Header.Get(slackTimestampHeader), r.Header.Get(slackSignatureHeader), body, s.now())
+	if err != nil {
+		glog.Errorf("Rejecting slack event callback from %s. err=%s\n", r.RemoteAddr, err.Error())
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	// interactive payloads are form encoded, events are JSON
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		s.handleInteraction(w, body)
+		return
+	}
+
+	var verification types.URLVerification
+	if err = json.Unmarshal(body, &verification); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	switch verification.Type {
+	case types.URLVerificationType:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(verification.Challenge))
+	case types.EventCallbackType:
+		var cb types.EventCallback
+		if err = json.Unmarshal(body, &cb); err != nil {
+			http.Error(w, "invalid event callback", http.StatusBadRequest)
+			return
+		}
+		s.handleEvent(w, cb)
+	default:
+		glog.V(4).Infof("Ignoring slack callback of type %s\n", verification.Type)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *EventsServer) handleEvent(w http.ResponseWriter, cb types.EventCallback) {
+	if s.isDuplicate(cb.EventID) {
+		glog.V(4).Infof("Ignoring redelivered event %s\n", cb.EventID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	msg, ok := eventToMessage(cb.Event, s.UserID)
+	if !ok {
+		glog.V(9).Infof("Ignoring %s event\n", cb.Event.Type)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	select {
+	case s.messages <- msg:
+		w.WriteHeader(http.StatusOK)
+	case <-time.After(enqueueTimeout):
+		// forget the event so slack's retry is not dropped as a duplicate
+		s.seenLock.Lock()
+		delete(s.seen, cb.EventID)
+		s.seenLock.Unlock()
+		http.Error(w, "bot is busy", http.StatusServiceUnavailable)
+	}
+}
+
+func (s *EventsServer) handleInteraction(w http.ResponseWriter, body []byte) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil || form.Get("payload") == "" {
+		http.Error(w, "invalid interactive payload", http.StatusBadRequest)
+		return
+	}
+	var ic types.InteractionCallback
+	if err = json.Unmarshal([]byte(form.Get("payload")), &ic); err != nil {
+		http.Error(w, "invalid interactive payload", http.StatusBadRequest)
+		return
+	}
+	select {
+	case s.interactions <- ic:
+		w.WriteHeader(http.StatusOK)
+	case <-time.After(enqueueTimeout):
+		http.Error(w, "bot is busy", http.StatusServiceUnavailable)
+	}
+}
+
+// Interactions returns a channel on which interactive payloads, e.g. button clicks, are published
+func (s *EventsServer) Interactions() <-chan types.InteractionCallback {
+	return s.interactions
+}
+
+// ReadMessage reads the next message addressed to the bot
+func (s *EventsServer) ReadMessage() (m types.Message, err error) {
+	select {
+	case m = <-s.messages:
+		return
+	case <-s.done:
+		return m, ErrConnClosed
+	}
+}
+
+// BotUserID returns the slack user ID of the bot
+func (s *EventsServer) BotUserID() string {
+	return s.UserID
+}
+
+// SendMessage posts a message from the slack bot
+func (s *EventsServer) SendMessage(m types.Message) error {
+	_, err := s.PostMessage(m)
+	return err
+}
+
+// Close stops the events HTTP server
+func (s *EventsServer) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if s.server != nil {
+			err = s.server.Close()
+		}
+	})
+	return err
+}
+
+// eventToMessage converts an Events API event addressed to the bot into the message format read off the RTM socket.
+// Direct messages don't mention the bot, so they are prefixed with the mention to parse like any other request.
+func eventToMessage(ev types.Event, botUserID string) (m types.Message, ok bool) {
+	if ev.BotID != "" || ev.Subtype != "" || ev.User == botUserID {
+		return
+	}
+	text := ev.Text
+	switch {
+	case ev.Type == types.AppMentionEvent:
+	case ev.Type == types.MessageType && ev.ChannelType == types.DirectMessageChannelType:
+		mention := "<@" + botUserID + ">"
+		if !strings.HasPrefix(text, mention) {
+			text = mention + " " + text
+		}
+	default:
+		return
+	}
+	m = types.Message{
+		Type:     types.MessageType,
+		Channel:  ev.Channel,
+		Text:     text,
+		User:     ev.User,
+		Ts:       ev.Ts,
+		ThreadTs: ev.ThreadTs,
+	}
+	ok = true
+	return
+}
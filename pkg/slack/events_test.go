@@ -0,0 +1,154 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventToMessage(t *testing.T) {
+	Convey("eventToMessage", t, func() {
+		botUserID := "UBOT"
+		Convey("should convert an app mention into a message", func() {
+			ev := types.Event{Type: types.AppMentionEvent, User: "UCRAY7Q", Channel: "C1", Text: "<@UBOT> !help"}
+			actual, ok := eventToMessage(ev, botUserID)
+			So(ok, ShouldBeTrue)
+			So(actual.Type, ShouldEqual, types.MessageType)
+			So(actual.Channel, ShouldEqual, "C1")
+			So(actual.User, ShouldEqual, "UCRAY7Q")
+			So(actual.Text, ShouldEqual, "<@UBOT> !help")
+		})
+		Convey("should prefix direct messages with the bot mention", func() {
+			ev := types.Event{Type: types.MessageType, ChannelType: types.DirectMessageChannelType, User: "UCRAY7Q", Channel: "D1", Text: "!help"}
+			actual, ok := eventToMessage(ev, botUserID)
+			So(ok, ShouldBeTrue)
+			So(actual.Text, ShouldEqual, "<@UBOT> !help")
+		})
+		Convey("should not prefix direct messages that already mention the bot", func() {
+			ev := types.Event{Type: types.MessageType, ChannelType: types.DirectMessageChannelType, User: "UCRAY7Q", Channel: "D1", Text: "<@UBOT> !help"}
+			actual, ok := eventToMessage(ev, botUserID)
+			So(ok, ShouldBeTrue)
+			So(actual.Text, ShouldEqual, "<@UBOT> !help")
+		})
+		Convey("should ignore channel messages, edits and messages from bots", func() {
+			_, ok := eventToMessage(types.Event{Type: types.MessageType, ChannelType: "channel", User: "UCRAY7Q", Text: "hi"}, botUserID)
+			So(ok, ShouldBeFalse)
+			_, ok = eventToMessage(types.Event{Type: types.MessageType, ChannelType: types.DirectMessageChannelType, Subtype: "message_changed"}, botUserID)
+			So(ok, ShouldBeFalse)
+			_, ok = eventToMessage(types.Event{Type: types.MessageType, ChannelType: types.DirectMessageChannelType, User: botUserID, Text: "reply"}, botUserID)
+			So(ok, ShouldBeFalse)
+			_, ok = eventToMessage(types.Event{Type: types.AppMentionEvent, BotID: "B1", Text: "<@UBOT> !help"}, botUserID)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func signTestRequest(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	Convey("verifySignature", t, func() {
+		secret := "8f742231b10e8888abcd99yyyzzz85a5"
+		now := time.Unix(1531420618, 0)
+		timestamp := "1531420618"
+		body := []byte(`{"type":"url_verification","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`)
+		signature := signTestRequest(secret, timestamp, body)
+
+		Convey("should accept a request signed with the signing secret", func() {
+			So(verifySignature(secret, timestamp, signature, body, now), ShouldBeNil)
+		})
+		Convey("should reject a request signed with another secret", func() {
+			So(verifySignature("not-the-secret", timestamp, signature, body, now), ShouldNotBeNil)
+		})
+		Convey("should reject a tampered body", func() {
+			So(verifySignature(secret, timestamp, signature, []byte(`{"type":"event_callback"}`), now), ShouldNotBeNil)
+		})
+		Convey("should reject a replayed request", func() {
+			So(verifySignature(secret, timestamp, signature, body, now.Add(6*time.Minute)), ShouldNotBeNil)
+		})
+		Convey("should reject a missing timestamp", func() {
+			So(verifySignature(secret, "", signature, body, now), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEventsServerServeHTTP(t *testing.T) {
+	Convey("EventsServer.ServeHTTP", t, func() {
+		secret := "unit-test-secret"
+		now := time.Unix(1531420618, 0)
+		s := newEventsServer(secret, "xoxb-unit-test", "UBOT")
+		s.now = func() time.Time { return now }
+
+		post := func(body string, sign bool) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/slack/events", strings.NewReader(body))
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+			req.Header.Set(slackTimestampHeader, timestamp)
+			if sign {
+				req.Header.Set(slackSignatureHeader, signTestRequest(secret, timestamp, []byte(body)))
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			return rec
+		}
+
+		Convey("should answer the url verification challenge", func() {
+			rec := post(`{"type":"url_verification","token":"t","challenge":"unit-test-challenge"}`, true)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Body.String(), ShouldEqual, "unit-test-challenge")
+		})
+		Convey("should reject unsigned requests", func() {
+			rec := post(`{"type":"url_verification","token":"t","challenge":"unit-test-challenge"}`, false)
+			So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+			So(rec.Body.String(), ShouldNotContainSubstring, "unit-test-challenge")
+		})
+		Convey("should queue app mentions for the bot once", func() {
+			body := `{"type":"event_callback","event_id":"Ev1","event":{"type":"app_mention","user":"UCRAY7Q","text":"<@UBOT> !help","channel":"C1","ts":"1531420618.000100"}}`
+			So(post(body, true).Code, ShouldEqual, http.StatusOK)
+			So(post(body, true).Code, ShouldEqual, http.StatusOK)
+
+			msg, err := s.ReadMessage()
+			So(err, ShouldBeNil)
+			So(msg.Text, ShouldEqual, "<@UBOT> !help")
+			So(msg.User, ShouldEqual, "UCRAY7Q")
+			So(len(s.messages), ShouldEqual, 0)
+		})
+		Convey("should publish signed interactive payloads", func() {
+			payload := `{"type":"block_actions","user":{"id":"UCRAY7Q"},"channel":{"id":"C1"},"message":{"ts":"1531420618.000100"},"actions":[{"action_id":"approve_kube2iam","value":"foo arn hydrogen"}]}`
+			body := url.Values{"payload": {payload}}.Encode()
+			req := httptest.NewRequest("POST", "/slack/events", strings.NewReader(body))
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set(slackTimestampHeader, timestamp)
+			req.Header.Set(slackSignatureHeader, signTestRequest(secret, timestamp, []byte(body)))
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+
+			ic := <-s.Interactions()
+			So(ic.Type, ShouldEqual, types.BlockActionsType)
+			So(ic.User.ID, ShouldEqual, "UCRAY7Q")
+			So(ic.Message.Ts, ShouldEqual, "1531420618.000100")
+			So(ic.Actions[0].ActionID, ShouldEqual, types.ApproveKube2IamAction)
+		})
+		Convey("should report a closed server to readers", func() {
+			s.Close()
+			_, err := s.ReadMessage()
+			So(err, ShouldEqual, ErrConnClosed)
+		})
+	})
+}
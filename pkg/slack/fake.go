@@ -0,0 +1,168 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+)
+
+// FakeReply represents a response recorded by FakeTransport
+type FakeReply struct {
+	Channel   string
+	User      string
+	Ts        string
+	ThreadTs  string
+	Text      string
+	Blocks    []types.Block
+	Ephemeral bool
+	Direct    bool
+	Broadcast bool
+	Updated   bool
+}
+
+// FakeTransport is an in-memory Transport for tests.
+// Messages injected with Inject are returned by ReadMessage, everything the bot sends is recorded in Replies.
+type FakeTransport struct {
+	UserID string
+
+	incoming     chan types.Message
+	interactions chan types.InteractionCallback
+	done         chan struct{}
+	closeOnce    sync.Once
+	lock         sync.Mutex // guards users and replies
+	users        map[string]types.SlackUser
+	replies      []FakeReply
+	sent         chan FakeReply
+}
+
+// NewFakeTransport creates a FakeTransport for the bot user botUserID
+func NewFakeTransport(botUserID string) *FakeTransport {
+	return &FakeTransport{
+		UserID:       botUserID,
+		incoming:     make(chan types.Message, 64),
+		interactions: make(chan types.InteractionCallback, 64),
+		done:         make(chan struct{}),
+		users:        make(map[string]types.SlackUser),
+		sent:         make(chan FakeReply, 64),
+	}
+}
+
+// AddUser makes usr known to LookupUser
+func (f *FakeTransport) AddUser(usr types.SlackUser) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.users[usr.ID] = usr
+}
+
+// Inject queues m to be returned by ReadMessage
+func (f *FakeTransport) Inject(m types.Message) {
+	f.incoming <- m
+}
+
+// InjectInteraction queues ic to be published on Interactions
+func (f *FakeTransport) InjectInteraction(ic types.InteractionCallback) {
+	f.interactions <- ic
+}
+
+// Interactions returns the channel on which injected interactive payloads are published
+func (f *FakeTransport) Interactions() <-chan types.InteractionCallback {
+	return f.interactions
+}
+
+// Replies returns everything the bot has sent so far
+func (f *FakeTransport) Replies() []FakeReply {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]FakeReply(nil), f.replies...)
+}
+
+// Sent returns a channel on which every reply is published as it is sent
+func (f *FakeTransport) Sent() <-chan FakeReply {
+	return f.sent
+}
+
+func (f *FakeTransport) record(r FakeReply) {
+	f.lock.Lock()
+	f.replies = append(f.replies, r)
+	f.lock.Unlock()
+	select {
+	case f.sent <- r:
+	default:
+	}
+}
+
+// ReadMessage returns the next injected message
+func (f *FakeTransport) ReadMessage() (m types.Message, err error) {
+	select {
+	case m = <-f.incoming:
+		return
+	case <-f.done:
+		return m, ErrConnClosed
+	}
+}
+
+// SendMessage records m
+func (f *FakeTransport) SendMessage(m types.Message) error {
+	f.record(FakeReply{Channel: m.Channel, User: m.User, ThreadTs: m.ThreadTs, Text: m.Text, Blocks: m.Blocks, Broadcast: m.ReplyBroadcast})
+	return nil
+}
+
+// UpdateMessage records an edit of the message m.Ts
+func (f *FakeTransport) UpdateMessage(m types.Message) error {
+	f.record(FakeReply{Channel: m.Channel, Ts: m.Ts, Text: m.Text, Blocks: m.Blocks, Updated: true})
+	return nil
+}
+
+// PostToThread records a threaded reply
+func (f *FakeTransport) PostToThread(channel, threadTs, text string) error {
+	f.record(FakeReply{Channel: channel, ThreadTs: threadTs, Text: text})
+	return nil
+}
+
+// SendEphemeral records an ephemeral reply to user
+func (f *FakeTransport) SendEphemeral(channel, user, text string) error {
+	f.record(FakeReply{Channel: channel, User: user, Text: text, Ephemeral: true})
+	return nil
+}
+
+// SendDirectMessage records a direct message to user
+func (f *FakeTransport) SendDirectMessage(user, text string) error {
+	f.record(FakeReply{User: user, Text: text, Direct: true})
+	return nil
+}
+
+// LookupUserByEmail returns a user added with AddUser by their email
+func (f *FakeTransport) LookupUserByEmail(email string) (types.SlackUser, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, usr := range f.users {
+		if strings.EqualFold(usr.Profile.Email, email) {
+			return usr, nil
+		}
+	}
+	return types.SlackUser{}, fmt.Errorf("no slack user has email %s", email)
+}
+
+// LookupUser returns a user added with AddUser
+func (f *FakeTransport) LookupUser(id string) (types.SlackUser, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	usr, ok := f.users[id]
+	if !ok {
+		return usr, fmt.Errorf("slack user %s is not known to the bot", id)
+	}
+	return usr, nil
+}
+
+// BotUserID returns the slack user ID of the fake bot
+func (f *FakeTransport) BotUserID() string {
+	return f.UserID
+}
+
+// Close makes ReadMessage return ErrConnClosed
+func (f *FakeTransport) Close() error {
+	f.closeOnce.Do(func() { close(f.done) })
+	return nil
+}
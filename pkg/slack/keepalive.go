@@ -0,0 +1,112 @@
+package slack
+
+import (
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+	"golang.org/x/net/websocket"
+)
+
+// Keepalive defaults used by NewSlackServerConn
+var (
+	DefaultPingInterval = 30 * time.Second
+	DefaultPongTimeout  = 90 * time.Second
+)
+
+// keepalive pings slack every pingInterval and forces a reconnect when pongs stop arriving
+func (s *ServerConn) keepalive() {
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		if s.State() != StateConnected {
+			continue
+		}
+
+		conn := s.getConn()
+		if oldest, stale := s.isStale(time.Now()); stale {
+			glog.Errorf("No pong from slack since ping sent at %s, dropping socket to force a reconnect\n", oldest.Format(time.RFC3339))
+			// the reader sees the closed socket and reconnects
+			conn.Close()
+			continue
+		}
+		if err := s.sendPing(conn, time.Now()); err != nil {
+			glog.Errorf("Failed to ping slack. err=%s\n", err.Error())
+		}
+	}
+}
+
+func (s *ServerConn) sendPing(conn *websocket.Conn, now time.Time) error {
+	ping := types.Ping{
+		ID:   s.getNextMessageID(),
+		Type: types.PingType,
+		Time: now.UnixNano() / int64(time.Millisecond),
+	}
+	s.pingLock.Lock()
+	s.pendingPings[ping.ID] = now
+	s.pingLock.Unlock()
+
+	glog.V(8).Infof("Sending ping id=%d\n", ping.ID)
+	return websocket.JSON.Send(conn, ping)
+}
+
+// handlePong records the round trip of the ping the pong replies to
+func (s *ServerConn) handlePong(replyTo uint64, now time.Time) {
+	s.pingLock.Lock()
+	defer s.pingLock.Unlock()
+
+	sent, ok := s.pendingPings[replyTo]
+	if !ok {
+		glog.V(4).Infof("Ignoring pong for unknown ping id=%d\n", replyTo)
+		return
+	}
+	// slack answers pings in order, so anything older than this one is not coming back
+	for id, t := range s.pendingPings {
+		if !t.After(sent) {
+			delete(s.pendingPings, id)
+		}
+	}
+	s.latency = now.Sub(sent)
+	s.lastPong = now
+	glog.V(8).Infof("Pong for ping id=%d, latency=%s\n", replyTo, s.latency)
+}
+
+// isStale reports whether the oldest unanswered ping has been outstanding for longer than pongTimeout
+func (s *ServerConn) isStale(now time.Time) (oldest time.Time, stale bool) {
+	s.pingLock.Lock()
+	defer s.pingLock.Unlock()
+
+	for _, t := range s.pendingPings {
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	stale = !oldest.IsZero() && now.Sub(oldest) > s.pongTimeout
+	return
+}
+
+// resetPings forgets pings sent over a previous socket
+func (s *ServerConn) resetPings() {
+	s.pingLock.Lock()
+	s.pendingPings = make(map[uint64]time.Time)
+	s.pingLock.Unlock()
+}
+
+// Latency returns the round trip time of the last answered ping, zero if none was answered yet
+func (s *ServerConn) Latency() time.Duration {
+	s.pingLock.Lock()
+	defer s.pingLock.Unlock()
+	return s.latency
+}
+
+// LastPong returns when slack last answered a ping
+func (s *ServerConn) LastPong() time.Time {
+	s.pingLock.Lock()
+	defer s.pingLock.Unlock()
+	return s.lastPong
+}
@@ -0,0 +1,74 @@
+package slack
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestKeepaliveConn() *ServerConn {
+	return &ServerConn{
+		pongTimeout:  time.Minute,
+		pendingPings: make(map[uint64]time.Time),
+	}
+}
+
+func TestHandlePong(t *testing.T) {
+	Convey("handlePong", t, func() {
+		s := newTestKeepaliveConn()
+		sent := time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC)
+		s.pendingPings[1] = sent
+		s.pendingPings[2] = sent.Add(30 * time.Second)
+
+		Convey("should record the round trip latency of the answered ping", func() {
+			s.handlePong(1, sent.Add(150*time.Millisecond))
+			So(s.Latency(), ShouldEqual, 150*time.Millisecond)
+			So(s.LastPong(), ShouldResemble, sent.Add(150*time.Millisecond))
+		})
+		Convey("should forget the answered ping and older ones", func() {
+			s.handlePong(2, sent.Add(31*time.Second))
+			So(len(s.pendingPings), ShouldEqual, 0)
+		})
+		Convey("should keep newer pings outstanding", func() {
+			s.handlePong(1, sent.Add(time.Second))
+			So(len(s.pendingPings), ShouldEqual, 1)
+			So(s.pendingPings, ShouldContainKey, uint64(2))
+		})
+		Convey("should ignore pongs for unknown pings", func() {
+			s.handlePong(42, sent.Add(time.Second))
+			So(s.Latency(), ShouldEqual, 0)
+			So(len(s.pendingPings), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestIsStale(t *testing.T) {
+	Convey("isStale", t, func() {
+		s := newTestKeepaliveConn()
+		sent := time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC)
+
+		Convey("should not report a socket with no outstanding pings", func() {
+			_, stale := s.isStale(sent.Add(time.Hour))
+			So(stale, ShouldBeFalse)
+		})
+		Convey("should not report a ping still within the pong timeout", func() {
+			s.pendingPings[1] = sent
+			_, stale := s.isStale(sent.Add(59 * time.Second))
+			So(stale, ShouldBeFalse)
+		})
+		Convey("should report the oldest ping that outlived the pong timeout", func() {
+			s.pendingPings[1] = sent
+			s.pendingPings[2] = sent.Add(30 * time.Second)
+			oldest, stale := s.isStale(sent.Add(61 * time.Second))
+			So(stale, ShouldBeTrue)
+			So(oldest, ShouldResemble, sent)
+		})
+		Convey("should forget pings after the socket is replaced", func() {
+			s.pendingPings[1] = sent
+			s.resetPings()
+			_, stale := s.isStale(sent.Add(time.Hour))
+			So(stale, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,271 @@
+package slack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/websocket"
+)
+
+// ErrConnClosed is returned once the connection to slack has been closed by the bot
+var ErrConnClosed = errors.New("slack server connection closed")
+
+// ConnState represents the state of the RTM connection to slack
+type ConnState int
+
+// Connection states reported on ServerConn.StateChanges
+const (
+	StateDisconnected ConnState = iota
+	StateConnecting
+	StateConnected
+	StateClosed
+)
+
+func (cs ConnState) String() string {
+	switch cs {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("unknown(%d)", int(cs))
+}
+
+// Backoff represents the exponential backoff policy used when (re)connecting to slack
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+}
+
+// DefaultBackoff is the backoff policy used by NewSlackServerConn
+var DefaultBackoff = Backoff{
+	Initial: 1 * time.Second,
+	Max:     2 * time.Minute,
+	Factor:  2,
+}
+
+// next returns the delay to wait after a failed attempt that was preceded by a delay of cur
+func (b Backoff) next(cur time.Duration) time.Duration {
+	if cur <= 0 {
+		return b.Initial
+	}
+	next := time.Duration(float64(cur) * b.Factor)
+	if next > b.Max || next <= 0 {
+		next = b.Max
+	}
+	return next
+}
+
+// RTMError represents an error reported by slack in response to rtm.start
+type RTMError struct {
+	Code string
+}
+
+func (e *RTMError) Error() string {
+	return fmt.Sprintf("Slack RTM error=%s", e.Code)
+}
+
+// retryableRTMErrors are the rtm.start and Web API error codes that can go away on their own
+var retryableRTMErrors = map[string]bool{
+	"ratelimited":         true,
+	"request_timeout":     true,
+	"fatal_error":         true,
+	"internal_error":      true,
+	"service_unavailable": true,
+}
+
+// isPermanentError reports whether retrying to connect after err is pointless, e.g. on a revoked token
+func isPermanentError(err error) bool {
+	var rtmErr *RTMError
+	if errors.As(err, &rtmErr) {
+		return !retryableRTMErrors[rtmErr.Code]
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return !retryableRTMErrors[apiErr.Code]
+	}
+	return false
+}
+
+// isConnError reports whether err, returned while reading from the websocket, means the socket is unusable.
+// Errors decoding a single frame leave the connection intact.
+func isConnError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr)
+}
+
+func (s *ServerConn) setState(st ConnState) {
+	s.lock.Lock()
+	if s.state == st {
+		s.lock.Unlock()
+		return
+	}
+	s.state = st
+	if st == StateConnected {
+		close(s.ready)
+	} else if s.isReady() {
+		s.ready = make(chan struct{})
+	}
+	s.lock.Unlock()
+
+	glog.V(1).Infof("Slack connection state changed to %s\n", st)
+	select {
+	case s.stateChanges <- st:
+	default:
+		glog.V(4).Infof("Dropped slack connection state change to %s, nobody is listening\n", st)
+	}
+}
+
+// isReady must be called with s.lock held
+func (s *ServerConn) isReady() bool {
+	select {
+	case <-s.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// State returns the current state of the connection to slack
+func (s *ServerConn) State() ConnState {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.state
+}
+
+// StateChanges returns a channel on which connection state transitions are published.
+// Transitions are dropped when the channel is not drained.
+func (s *ServerConn) StateChanges() <-chan ConnState {
+	return s.stateChanges
+}
+
+func (s *ServerConn) getConn() *websocket.Conn {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.conn
+}
+
+func (s *ServerConn) getURL() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.URL
+}
+
+// waitForConn returns the current websocket, waiting up to timeout for an in-progress reconnect to finish
+func (s *ServerConn) waitForConn(timeout time.Duration) (*websocket.Conn, error) {
+	s.lock.RLock()
+	ready := s.ready
+	s.lock.RUnlock()
+
+	select {
+	case <-ready:
+		return s.getConn(), nil
+	case <-s.done:
+		return nil, ErrConnClosed
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timed out after %s waiting for connection to slack", timeout)
+	}
+}
+
+func (s *ServerConn) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// dial starts a new RTM session and swaps it in as the current websocket
+func (s *ServerConn) dial() error {
+	wsURL, userID, err := startSlackRTM(s.token)
+	if err != nil {
+		return err
+	}
+	conn, err := getSlackConn(wsURL)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.UserID != "" && s.UserID != userID {
+		glog.Warningf("Slack bot user changed from %s to %s across reconnects, keeping %s\n", s.UserID, userID, s.UserID)
+	} else {
+		s.UserID = userID
+	}
+	s.URL = wsURL
+	s.conn = conn
+	s.resetPings()
+	return nil
+}
+
+// connect dials slack until it succeeds, retrying with exponential backoff
+func (s *ServerConn) connect() error {
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		if s.isClosed() {
+			return ErrConnClosed
+		}
+		s.setState(StateConnecting)
+		err := s.dial()
+		if err == nil {
+			s.setState(StateConnected)
+			return nil
+		}
+		s.setState(StateDisconnected)
+		if isPermanentError(err) {
+			return err
+		}
+
+		delay = s.backoff.next(delay)
+		glog.Errorf("Attempt %d to connect to slack failed, retrying in %s. err=%s\n", attempt, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-s.done:
+			return ErrConnClosed
+		}
+	}
+}
+
+// reconnect replaces the failed websocket with a new RTM session.
+// Concurrent callers reporting the same failed socket result in a single reconnect.
+func (s *ServerConn) reconnect(failed *websocket.Conn) error {
+	s.reconnectLock.Lock()
+	defer s.reconnectLock.Unlock()
+
+	if s.getConn() != failed {
+		// somebody else has already replaced this socket
+		return nil
+	}
+	failed.Close()
+	s.setState(StateDisconnected)
+	err := s.connect()
+	if err != nil && err != ErrConnClosed {
+		// reconnecting can't succeed, e.g. the token was revoked
+		s.Close()
+	}
+	return err
+}
+
+// Close shuts down the connection to slack and stops any reconnect in progress
+func (s *ServerConn) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if conn := s.getConn(); conn != nil {
+			err = conn.Close()
+		}
+		s.setState(StateClosed)
+	})
+	return err
+}
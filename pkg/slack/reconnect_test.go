@@ -0,0 +1,144 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/websocket"
+)
+
+func TestBackoffNext(t *testing.T) {
+	Convey("Backoff.next", t, func() {
+		b := Backoff{Initial: time.Second, Max: 10 * time.Second, Factor: 2}
+		Convey("should start with the initial delay", func() {
+			So(b.next(0), ShouldEqual, time.Second)
+		})
+		Convey("should grow the delay by the factor", func() {
+			So(b.next(time.Second), ShouldEqual, 2*time.Second)
+			So(b.next(4*time.Second), ShouldEqual, 8*time.Second)
+		})
+		Convey("should not exceed the max delay", func() {
+			So(b.next(8*time.Second), ShouldEqual, 10*time.Second)
+			So(b.next(10*time.Second), ShouldEqual, 10*time.Second)
+		})
+	})
+}
+
+func TestConnStateString(t *testing.T) {
+	Convey("ConnState.String should describe the connection state", t, func() {
+		So(StateDisconnected.String(), ShouldEqual, "disconnected")
+		So(StateConnecting.String(), ShouldEqual, "connecting")
+		So(StateConnected.String(), ShouldEqual, "connected")
+		So(StateClosed.String(), ShouldEqual, "closed")
+		So(ConnState(42).String(), ShouldEqual, "unknown(42)")
+	})
+}
+
+func TestIsPermanentError(t *testing.T) {
+	Convey("isPermanentError", t, func() {
+		Convey("should treat authentication failures as permanent", func() {
+			So(isPermanentError(&RTMError{Code: "invalid_auth"}), ShouldBeTrue)
+			So(isPermanentError(fmt.Errorf("wrapped: %w", &RTMError{Code: "token_revoked"})), ShouldBeTrue)
+			So(isPermanentError(&APIError{Method: "apps.connections.open", Code: "invalid_auth"}), ShouldBeTrue)
+		})
+		Convey("should retry transient slack and network failures", func() {
+			So(isPermanentError(&RTMError{Code: "ratelimited"}), ShouldBeFalse)
+			So(isPermanentError(&APIError{Method: "apps.connections.open", Code: "internal_error"}), ShouldBeFalse)
+			So(isPermanentError(io.EOF), ShouldBeFalse)
+		})
+	})
+}
+
+func TestIsConnError(t *testing.T) {
+	Convey("isConnError", t, func() {
+		Convey("should report socket failures", func() {
+			So(isConnError(io.EOF), ShouldBeTrue)
+		})
+		Convey("should not report a frame that failed to decode", func() {
+			var v struct{ ID uint64 }
+			err := json.Unmarshal([]byte(`{"ID":"not-a-number"}`), &v)
+			So(isConnError(err), ShouldBeFalse)
+			err = json.Unmarshal([]byte(`{"ID":`), &v)
+			So(isConnError(err), ShouldBeFalse)
+		})
+	})
+}
+
+func TestNewSlackServerConn(t *testing.T) {
+	Convey("NewSlackServerConn should fail without retrying when token is empty", t, func() {
+		conn, err := NewSlackServerConn("")
+		So(conn, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestServerConnClose(t *testing.T) {
+	Convey("ServerConn.Close", t, func() {
+		s := &ServerConn{
+			ready:        make(chan struct{}),
+			stateChanges: make(chan ConnState, 16),
+			done:         make(chan struct{}),
+		}
+		So(s.Close(), ShouldBeNil)
+		Convey("should report the closed state", func() {
+			So(s.State(), ShouldEqual, StateClosed)
+			So(<-s.StateChanges(), ShouldEqual, StateClosed)
+		})
+		Convey("should fail sends instead of waiting for a reconnect", func() {
+			_, err := s.waitForConn(time.Minute)
+			So(err, ShouldEqual, ErrConnClosed)
+		})
+		Convey("should stop connect attempts", func() {
+			So(s.connect(), ShouldEqual, ErrConnClosed)
+		})
+	})
+}
+
+// rtmStartTransport answers every HTTP request with the rtm.start response body it is
+type rtmStartTransport string
+
+func (t rtmStartTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(string(t))),
+		Request:    r,
+	}, nil
+}
+
+func TestServerConnReconnect(t *testing.T) {
+	Convey("ServerConn.reconnect", t, func() {
+		srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+			io.Copy(io.Discard, ws)
+		}))
+		defer srv.Close()
+		failed, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+		So(err, ShouldBeNil)
+		s := &ServerConn{
+			backoff:      DefaultBackoff,
+			conn:         failed,
+			ready:        make(chan struct{}),
+			stateChanges: make(chan ConnState, 16),
+			done:         make(chan struct{}),
+		}
+		s.token = "xoxb-revoked"
+
+		Convey("should close the connection when slack won't start a session again", func() {
+			transport := http.DefaultTransport
+			http.DefaultTransport = rtmStartTransport(`{"ok":false,"error":"token_revoked"}`)
+			defer func() { http.DefaultTransport = transport }()
+
+			err := s.reconnect(failed)
+			So(isPermanentError(err), ShouldBeTrue)
+			So(s.State(), ShouldEqual, StateClosed)
+			So(s.isClosed(), ShouldBeTrue)
+		})
+	})
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ashish-amarnath/slackbots/pkg/types"
 	"github.com/ashish-amarnath/slackbots/pkg/utils"
@@ -14,15 +16,38 @@ import (
 )
 
 var (
-	SlackUserMap map[string]types.SlackUser
+	SlackUserMap     map[string]types.SlackUser
+	slackUserMapLock sync.RWMutex
+	// APIBaseURL is the slack Web API the bot talks to, overridden to run against a fake slack
+	APIBaseURL = types.SlackWebAPIURL
 )
 
-// ServerConn represents an RTM connection to slack
+// sendTimeout bounds how long SendMessage waits for an in-progress reconnect
+const sendTimeout = 30 * time.Second
+
+// ServerConn represents an RTM connection to slack that reconnects when the websocket drops
 type ServerConn struct {
 	URL    string
 	conn   *websocket.Conn
 	UserID string
 	msgID  uint64
+	WebClient
+
+	backoff       Backoff
+	lock          sync.RWMutex // guards URL, UserID, conn, state and ready
+	reconnectLock sync.Mutex
+	state         ConnState
+	ready         chan struct{} // closed while state is StateConnected
+	stateChanges  chan ConnState
+	done          chan struct{}
+	closeOnce     sync.Once
+
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	pingLock     sync.Mutex // guards pendingPings, latency and lastPong
+	pendingPings map[uint64]time.Time
+	latency      time.Duration
+	lastPong     time.Time
 }
 
 func parseRtmStartResponse(respBytes []byte) (respJSON types.ResponseRtmStart, err error) {
@@ -31,7 +56,7 @@ func parseRtmStartResponse(respBytes []byte) (respJSON types.ResponseRtmStart, e
 }
 
 func getSlackRTMURL(token string) string {
-	return fmt.Sprintf(types.SlackRtmURLFmt, token)
+	return fmt.Sprintf(types.SlackRtmURLFmt, APIBaseURL, token)
 }
 
 func startSlackRTM(token string) (wsURL, userID string, err error) {
@@ -43,15 +68,18 @@ func startSlackRTM(token string) (wsURL, userID string, err error) {
 	glog.V(3).Infof("Contacting slack rtm server at %s\n", rtmURL)
 
 	resp, err := http.Get(rtmURL)
-	if err != nil || resp.StatusCode != 200 {
-		glog.Fatalf("Request to RTM server at %s failed with %d", rtmURL, resp.StatusCode)
+	if err != nil {
+		err = fmt.Errorf("request to RTM server failed, err=%s", err.Error())
 		return
 	}
-
 	rBody, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("request to RTM server failed with %d", resp.StatusCode)
+		return
+	}
 	if err != nil {
-		glog.Fatalf("Failed to read response body from RTM server at %s. err=%s\n", rtmURL, err)
+		err = fmt.Errorf("failed to read response body from RTM server, err=%s", err.Error())
 		return
 	}
 
@@ -59,13 +87,9 @@ func startSlackRTM(token string) (wsURL, userID string, err error) {
 	var respJSON types.ResponseRtmStart
 	respJSON, err = parseRtmStartResponse(rBody)
 	if err != nil {
-		glog.Fatalf("Slack RTM error:%s [Server=%s]\n", err, rtmURL)
+		err = fmt.Errorf("failed to parse RTM server response, err=%s", err.Error())
 		return
 	}
-	SlackUserMap = make(map[string]types.SlackUser)
-	for _, usr := range respJSON.Users {
-		SlackUserMap[usr.ID] = usr
-	}
 
 	glog.V(3).Infoln("Successfully unmarshalled RTMStart Response.")
 	glog.V(5).Infof("rtmStartResp.OK=%t\n", respJSON.Ok)
@@ -75,10 +99,10 @@ func startSlackRTM(token string) (wsURL, userID string, err error) {
 	glog.V(5).Infof("rtmStartResp.Self.Name=%s\n", respJSON.Bot.Name)
 
 	if !respJSON.Ok {
-		err = fmt.Errorf("Slack RTM error=%s", respJSON.Error)
-		glog.Fatalln(err)
+		err = &RTMError{Code: respJSON.Error}
 		return
 	}
+	setSlackUsers(respJSON.Users)
 
 	wsURL = respJSON.URL
 	userID = respJSON.Bot.ID
@@ -86,44 +110,122 @@ func startSlackRTM(token string) (wsURL, userID string, err error) {
 	return
 }
 
-func getSlackConn(webSockURL string) *websocket.Conn {
-	conn, err := websocket.Dial(webSockURL, "", types.SlackAPIServerURL)
+func setSlackUsers(users []types.SlackUser) {
+	userMap := make(map[string]types.SlackUser)
+	for _, usr := range users {
+		userMap[usr.ID] = usr
+	}
+	slackUserMapLock.Lock()
+	SlackUserMap = userMap
+	slackUserMapLock.Unlock()
+}
+
+func addSlackUser(usr types.SlackUser) {
+	slackUserMapLock.Lock()
+	if SlackUserMap == nil {
+		SlackUserMap = make(map[string]types.SlackUser)
+	}
+	SlackUserMap[usr.ID] = usr
+	slackUserMapLock.Unlock()
+}
+
+// GetSlackUser looks up a slack user by ID among the users known from the last RTM session
+func GetSlackUser(id string) (usr types.SlackUser, ok bool) {
+	slackUserMapLock.RLock()
+	defer slackUserMapLock.RUnlock()
+	usr, ok = SlackUserMap[id]
+	return
+}
+
+func getSlackConn(webSockURL string) (conn *websocket.Conn, err error) {
+	conn, err = websocket.Dial(webSockURL, "", types.SlackAPIServerURL)
 	if err != nil {
-		glog.Fatalf("Failed to dial to URL=%s err=%s\n", webSockURL, err)
-		return nil
+		err = fmt.Errorf("failed to dial to URL=%s err=%s", webSockURL, err.Error())
+		return
 	}
 	glog.V(1).Infof("Successfully connected to slackbot at %s\n", webSockURL)
-	return conn
+	return
 }
 
-// ReadMessage reads a message sent to the slackbot
+// ReadMessage reads a message sent to the slackbot.
+// When the websocket drops, ReadMessage blocks while the connection is re-established.
 func (s *ServerConn) ReadMessage() (m types.Message, err error) {
-	err = websocket.JSON.Receive(s.conn, &m)
-	return
+	for {
+		conn := s.getConn()
+		m = types.Message{}
+		err = websocket.JSON.Receive(conn, &m)
+		if err == nil && m.Type == types.PongType {
+			s.handlePong(m.ReplyTo, time.Now())
+			continue
+		}
+		if err == nil && m.Type != types.GoodbyeType {
+			return
+		}
+		if err != nil && !isConnError(err) {
+			return
+		}
+		if s.isClosed() {
+			return m, ErrConnClosed
+		}
+
+		if err != nil {
+			glog.Errorf("Lost connection to slack at %s. err=%s\n", s.getURL(), err.Error())
+		} else {
+			glog.V(1).Infof("Slack server at %s said goodbye, reconnecting\n", s.getURL())
+		}
+		if err = s.reconnect(conn); err != nil {
+			return
+		}
+	}
 }
 
 func (s *ServerConn) getNextMessageID() uint64 {
 	return atomic.AddUint64(&s.msgID, 1)
 }
 
-// SendMessage sends a message from the slack bot
+// SendMessage sends a message from the slack bot.
+// The RTM socket only carries plain text, so messages with blocks are posted with the Web API.
 func (s *ServerConn) SendMessage(m types.Message) error {
+	if len(m.Blocks) > 0 {
+		_, err := s.PostMessage(m)
+		return err
+	}
+	conn, err := s.waitForConn(sendTimeout)
+	if err != nil {
+		return err
+	}
 	m.ID = s.getNextMessageID()
 	glog.V(4).Infof("Reply=%s\n", utils.StringifyMessage(m))
-	return websocket.JSON.Send(s.conn, m)
+	return websocket.JSON.Send(conn, m)
 }
 
-//NewSlackServerConn creates and returns a new connection to the slackbot identfied by the token
-func NewSlackServerConn(token string) *ServerConn {
-	rtmURL, botUsr, err := startSlackRTM(token)
-	if err != nil {
-		glog.Fatalf("Failed to start slack RTM, err=%s\n", err.Error())
+// BotUserID returns the slack user ID the bot is connected as
+func (s *ServerConn) BotUserID() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.UserID
+}
+
+// NewSlackServerConn creates and returns a new connection to the slackbot identfied by the token
+func NewSlackServerConn(token string) (*ServerConn, error) {
+	if token == "" {
+		return nil, fmt.Errorf("expected non-empty slackbot integration token, got [%s]", token)
+	}
+	s := &ServerConn{
+		msgID:        0,
+		WebClient:    WebClient{token: token},
+		backoff:      DefaultBackoff,
+		state:        StateDisconnected,
+		ready:        make(chan struct{}),
+		stateChanges: make(chan ConnState, 16),
+		done:         make(chan struct{}),
+		pingInterval: DefaultPingInterval,
+		pongTimeout:  DefaultPongTimeout,
+		pendingPings: make(map[uint64]time.Time),
 	}
-	wsConn := getSlackConn(rtmURL)
-	return &ServerConn{
-		URL:    rtmURL,
-		UserID: botUsr,
-		conn:   wsConn,
-		msgID:  0,
+	if err := s.connect(); err != nil {
+		return nil, fmt.Errorf("failed to start slack RTM, err=%s", err.Error())
 	}
+	go s.keepalive()
+	return s, nil
 }
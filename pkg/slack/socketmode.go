@@ -0,0 +1,216 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+	"golang.org/x/net/websocket"
+)
+
+// SocketModeConn represents a Socket Mode connection to slack.
+// Events are received over a web socket opened with the app-level token, replies are posted with the bot token.
+type SocketModeConn struct {
+	UserID string
+	WebClient
+
+	appToken     string
+	botToken     string
+	backoff      Backoff
+	lock         sync.RWMutex // guards conn
+	conn         *websocket.Conn
+	interactions chan types.InteractionCallback
+	done         chan struct{}
+	closeOnce    sync.Once
+}
+
+// NewSocketModeConn creates and returns a new Socket Mode connection for the app identified by appToken
+func NewSocketModeConn(appToken, botToken string) (*SocketModeConn, error) {
+	if appToken == "" || botToken == "" {
+		return nil, fmt.Errorf("expected non-empty slack app and bot tokens for socket mode")
+	}
+	userID, err := authTest(botToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to identify slack bot user, err=%s", err.Error())
+	}
+	if err = loadSlackUsers(botToken); err != nil {
+		return nil, fmt.Errorf("failed to load slack users, err=%s", err.Error())
+	}
+
+	s := &SocketModeConn{
+		UserID:       userID,
+		WebClient:    WebClient{token: botToken},
+		appToken:     appToken,
+		botToken:     botToken,
+		backoff:      DefaultBackoff,
+		interactions: make(chan types.InteractionCallback, 16),
+		done:         make(chan struct{}),
+	}
+	if err = s.connect(); err != nil {
+		return nil, fmt.Errorf("failed to open socket mode connection, err=%s", err.Error())
+	}
+	return s, nil
+}
+
+func (s *SocketModeConn) getConn() *websocket.Conn {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.conn
+}
+
+func (s *SocketModeConn) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *SocketModeConn) dial() error {
+	wsURL, err := openSocketModeURL(s.appToken)
+	if err != nil {
+		return err
+	}
+	conn, err := getSlackConn(wsURL)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.conn = conn
+	s.lock.Unlock()
+	return nil
+}
+
+// connect opens a new socket, retrying with exponential backoff
+func (s *SocketModeConn) connect() error {
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		if s.isClosed() {
+			return ErrConnClosed
+		}
+		err := s.dial()
+		if err == nil {
+			return nil
+		}
+		if isPermanentError(err) {
+			return err
+		}
+		delay = s.backoff.next(delay)
+		glog.Errorf("Attempt %d to open socket mode connection failed, retrying in %s. err=%s\n", attempt, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-s.done:
+			return ErrConnClosed
+		}
+	}
+}
+
+func (s *SocketModeConn) reconnect(failed *websocket.Conn) error {
+	failed.Close()
+	err := s.connect()
+	if err != nil && err != ErrConnClosed {
+		s.Close()
+	}
+	return err
+}
+
+// ack acknowledges an envelope so slack does not redeliver it
+func (s *SocketModeConn) ack(conn *websocket.Conn, envelopeID string) {
+	if err := websocket.JSON.Send(conn, types.SocketModeAck{EnvelopeID: envelopeID}); err != nil {
+		glog.Errorf("Failed to acknowledge socket mode envelope %s. err=%s\n", envelopeID, err.Error())
+	}
+}
+
+// ReadMessage reads the next message addressed to the bot, acknowledging every envelope it receives
+func (s *SocketModeConn) ReadMessage() (m types.Message, err error) {
+	for {
+		conn := s.getConn()
+		var env types.SocketModeEnvelope
+		err = websocket.JSON.Receive(conn, &env)
+		if err != nil {
+			if !isConnError(err) {
+				return
+			}
+			if s.isClosed() {
+				return m, ErrConnClosed
+			}
+			glog.Errorf("Lost socket mode connection to slack. err=%s\n", err.Error())
+			if err = s.reconnect(conn); err != nil {
+				return
+			}
+			continue
+		}
+		if env.EnvelopeID != "" {
+			s.ack(conn, env.EnvelopeID)
+		}
+
+		switch env.Type {
+		case types.HelloType:
+			glog.V(1).Infoln("Socket mode connection to slack established")
+		case types.DisconnectType:
+			glog.V(1).Infof("Slack asked to disconnect socket mode connection, reason=%s\n", env.Reason)
+			if err = s.reconnect(conn); err != nil {
+				return
+			}
+		case types.EventsAPIType:
+			var cb types.EventCallback
+			if err = json.Unmarshal(env.Payload, &cb); err != nil {
+				glog.Errorf("Failed to parse events_api payload of envelope %s. err=%s\n", env.EnvelopeID, err.Error())
+				continue
+			}
+			if msg, ok := eventToMessage(cb.Event, s.UserID); ok {
+				return msg, nil
+			}
+			glog.V(9).Infof("Ignoring %s event\n", cb.Event.Type)
+		case types.InteractiveType:
+			var ic types.InteractionCallback
+			if err = json.Unmarshal(env.Payload, &ic); err != nil {
+				glog.Errorf("Failed to parse interactive payload of envelope %s. err=%s\n", env.EnvelopeID, err.Error())
+				continue
+			}
+			s.publishInteraction(ic)
+		default:
+			glog.V(4).Infof("Ignoring socket mode envelope of type %s\n", env.Type)
+		}
+	}
+}
+
+func (s *SocketModeConn) publishInteraction(ic types.InteractionCallback) {
+	select {
+	case s.interactions <- ic:
+	default:
+		glog.Errorf("Dropped %s interaction from user %s, nobody is listening\n", ic.Type, ic.User.ID)
+	}
+}
+
+// Interactions returns a channel on which interactive payloads, e.g. button clicks, are published
+func (s *SocketModeConn) Interactions() <-chan types.InteractionCallback {
+	return s.interactions
+}
+
+// BotUserID returns the slack user ID of the bot
+func (s *SocketModeConn) BotUserID() string {
+	return s.UserID
+}
+
+// SendMessage posts a message from the slack bot
+func (s *SocketModeConn) SendMessage(m types.Message) error {
+	_, err := s.PostMessage(m)
+	return err
+}
+
+// Close shuts down the socket mode connection
+func (s *SocketModeConn) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if conn := s.getConn(); conn != nil {
+			err = conn.Close()
+		}
+	})
+	return err
+}
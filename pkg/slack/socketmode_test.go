@@ -0,0 +1,18 @@
+package slack
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewSocketModeConn(t *testing.T) {
+	Convey("NewSocketModeConn should fail when a token is missing", t, func() {
+		conn, err := NewSocketModeConn("", "xoxb-bot")
+		So(conn, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		conn, err = NewSocketModeConn("xapp-app", "")
+		So(conn, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,39 @@
+package slack
+
+import (
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+)
+
+// Responder sends the bot's responses back to slack and looks up the users it talks to
+type Responder interface {
+	SendMessage(m types.Message) error
+	UpdateMessage(m types.Message) error
+	PostToThread(channel, threadTs, text string) error
+	SendEphemeral(channel, user, text string) error
+	SendDirectMessage(user, text string) error
+	LookupUser(id string) (types.SlackUser, error)
+	LookupUserByEmail(email string) (types.SlackUser, error)
+}
+
+// Transport is a connection to slack over which the bot receives requests and responds to them
+type Transport interface {
+	Responder
+	ReadMessage() (types.Message, error)
+	BotUserID() string
+	Close() error
+}
+
+// Interactive is implemented by transports that receive interactive payloads, e.g. clicks on message buttons
+type Interactive interface {
+	Interactions() <-chan types.InteractionCallback
+}
+
+var (
+	_ Transport   = &ServerConn{}
+	_ Transport   = &SocketModeConn{}
+	_ Transport   = &EventsServer{}
+	_ Transport   = &FakeTransport{}
+	_ Interactive = &SocketModeConn{}
+	_ Interactive = &EventsServer{}
+	_ Interactive = &FakeTransport{}
+)
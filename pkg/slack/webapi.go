@@ -0,0 +1,108 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+)
+
+var webAPIClient = &http.Client{Timeout: 30 * time.Second}
+
+// APIError represents an error reported by a slack Web API method
+type APIError struct {
+	Method string
+	Code   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("slack %s error=%s", e.Method, e.Code)
+}
+
+func getWebAPIURL(method string) string {
+	return fmt.Sprintf("%s/%s", APIBaseURL, method)
+}
+
+// callWebAPI posts params to the slack Web API method authenticated by token and unmarshals the response into out
+func callWebAPI(method, token string, params url.Values, out interface{}) error {
+	apiURL := getWebAPIURL(method)
+	req, err := http.NewRequest("POST", apiURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request to url=%s err=%s", apiURL, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	glog.V(6).Infof("Calling slack %s\n", method)
+	resp, err := webAPIClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to url=%s failed err=%s", apiURL, err.Error())
+	}
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read response from url=%s err=%s", apiURL, err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to url=%s failed with %d", apiURL, resp.StatusCode)
+	}
+	glog.V(8).Infof("slack %s response body[\n %s\n]\n", method, raw)
+
+	var base types.WebAPIResponse
+	if err = json.Unmarshal(raw, &base); err != nil {
+		return fmt.Errorf("failed to parse response from url=%s err=%s", apiURL, err.Error())
+	}
+	if !base.Ok {
+		return &APIError{Method: method, Code: base.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// authTest returns the slack user ID of the bot that owns token
+func authTest(token string) (userID string, err error) {
+	var resp types.AuthTestResp
+	if err = callWebAPI("auth.test", token, url.Values{}, &resp); err != nil {
+		return
+	}
+	userID = resp.UserID
+	return
+}
+
+// loadSlackUsers fetches every user in the workspace so they can be found with GetSlackUser
+func loadSlackUsers(token string) error {
+	var users []types.SlackUser
+	params := url.Values{"limit": {"200"}}
+	for {
+		var resp types.UsersListResp
+		if err := callWebAPI("users.list", token, params, &resp); err != nil {
+			return err
+		}
+		users = append(users, resp.Members...)
+		if resp.ResponseMetadata.NextCursor == "" {
+			break
+		}
+		params.Set("cursor", resp.ResponseMetadata.NextCursor)
+	}
+	glog.V(3).Infof("Loaded %d slack users\n", len(users))
+	setSlackUsers(users)
+	return nil
+}
+
+// openSocketModeURL requests a new Socket Mode web socket URL for the app identified by appToken
+func openSocketModeURL(appToken string) (wsURL string, err error) {
+	var resp types.ConnectionsOpenResp
+	if err = callWebAPI("apps.connections.open", appToken, url.Values{}, &resp); err != nil {
+		return
+	}
+	wsURL = resp.URL
+	return
+}
@@ -0,0 +1,133 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/ashish-amarnath/slackbots/pkg/utils"
+	"github.com/golang/glog"
+)
+
+// WebClient posts, updates and looks things up with the slack Web API.
+// It implements the Responder methods every transport has in common.
+type WebClient struct {
+	token string
+}
+
+// NewWebClient creates a WebClient authenticated with the bot token
+func NewWebClient(token string) *WebClient {
+	return &WebClient{token: token}
+}
+
+// messageParams returns the chat.postMessage and chat.update parameters for m
+func messageParams(m types.Message) (params url.Values, err error) {
+	params = url.Values{
+		"channel": {m.Channel},
+		"text":    {m.Text},
+	}
+	if len(m.Blocks) > 0 {
+		var blocks []byte
+		if blocks, err = json.Marshal(m.Blocks); err != nil {
+			err = fmt.Errorf("failed to marshal message blocks, err=%s", err.Error())
+			return
+		}
+		params.Set("blocks", string(blocks))
+	}
+	return
+}
+
+// PostMessage posts m to its channel, or the thread it belongs to, returning the ts of the posted message
+func (c WebClient) PostMessage(m types.Message) (ts string, err error) {
+	glog.V(4).Infof("Reply=%s\n", utils.StringifyMessage(m))
+	params, err := messageParams(m)
+	if err != nil {
+		return
+	}
+	if m.ThreadTs != "" {
+		params.Set("thread_ts", m.ThreadTs)
+		params.Set("reply_broadcast", strconv.FormatBool(m.ReplyBroadcast))
+	}
+	var resp types.PostMessageResp
+	if err = callWebAPI("chat.postMessage", c.token, params, &resp); err != nil {
+		return
+	}
+	ts = resp.Ts
+	return
+}
+
+// UpdateMessage replaces the text and blocks of the message m.Ts in m.Channel
+func (c WebClient) UpdateMessage(m types.Message) error {
+	if m.Ts == "" {
+		return fmt.Errorf("expected the ts of the message to update in channel %s", m.Channel)
+	}
+	params, err := messageParams(m)
+	if err != nil {
+		return err
+	}
+	params.Set("ts", m.Ts)
+	return callWebAPI("chat.update", c.token, params, nil)
+}
+
+// PostToThread posts text as a reply in the thread started by the message threadTs
+func (c WebClient) PostToThread(channel, threadTs, text string) error {
+	_, err := c.PostMessage(types.Message{Channel: channel, ThreadTs: threadTs, Text: text})
+	return err
+}
+
+// SendEphemeral posts text to channel so that only user can see it
+func (c WebClient) SendEphemeral(channel, user, text string) error {
+	params := url.Values{
+		"channel": {channel},
+		"user":    {user},
+		"text":    {text},
+	}
+	return callWebAPI("chat.postEphemeral", c.token, params, nil)
+}
+
+// SendDirectMessage sends text to user in their direct message conversation with the bot
+func (c WebClient) SendDirectMessage(user, text string) error {
+	var resp types.ConversationsOpenResp
+	if err := callWebAPI("conversations.open", c.token, url.Values{"users": {user}}, &resp); err != nil {
+		return fmt.Errorf("failed to open direct message conversation with %s, err=%s", user, err.Error())
+	}
+	_, err := c.PostMessage(types.Message{Channel: resp.Channel.ID, Text: text})
+	return err
+}
+
+// LookupUserByEmail returns the slack user with the supplied email, asking slack about users that joined after the bot started
+func (c WebClient) LookupUserByEmail(email string) (usr types.SlackUser, err error) {
+	slackUserMapLock.RLock()
+	for _, known := range SlackUserMap {
+		if strings.EqualFold(known.Profile.Email, email) {
+			slackUserMapLock.RUnlock()
+			return known, nil
+		}
+	}
+	slackUserMapLock.RUnlock()
+
+	var resp types.UsersInfoResp
+	if err = callWebAPI("users.lookupByEmail", c.token, url.Values{"email": {email}}, &resp); err != nil {
+		err = fmt.Errorf("failed to look up slack user with email %s, err=%s", email, err.Error())
+		return
+	}
+	addSlackUser(resp.User)
+	return resp.User, nil
+}
+
+// LookupUser returns the slack user with the supplied ID, asking slack about users that joined after the bot started
+func (c WebClient) LookupUser(id string) (usr types.SlackUser, err error) {
+	if usr, ok := GetSlackUser(id); ok {
+		return usr, nil
+	}
+	var resp types.UsersInfoResp
+	if err = callWebAPI("users.info", c.token, url.Values{"user": {id}}, &resp); err != nil {
+		err = fmt.Errorf("failed to look up slack user %s, err=%s", id, err.Error())
+		return
+	}
+	addSlackUser(resp.User)
+	return resp.User, nil
+}
@@ -0,0 +1,27 @@
+package slack
+
+import (
+	"testing"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupUserByEmail(t *testing.T) {
+	Convey("WebClient.LookupUserByEmail", t, func() {
+		var usr types.SlackUser
+		usr.ID = "UOWNER"
+		usr.Profile.FirstName = "John"
+		usr.Profile.LastName = "Doe"
+		usr.Profile.Email = "john.doe@johndoe.com"
+		setSlackUsers([]types.SlackUser{usr})
+		defer setSlackUsers(nil)
+		client := NewWebClient("xoxb-unit-test")
+
+		Convey("should find users known to the bot by email regardless of case", func() {
+			actual, err := client.LookupUserByEmail("John.Doe@johndoe.com")
+			So(err, ShouldBeNil)
+			So(actual.ID, ShouldEqual, "UOWNER")
+		})
+	})
+}
@@ -0,0 +1,301 @@
+// Package slacktest provides a local fake of the slack RTM and Web APIs for end-to-end tests of the bot.
+package slacktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+	"golang.org/x/net/websocket"
+)
+
+// Server is a fake slack serving rtm.start, a subset of the Web API and the RTM web socket.
+// Point slack.APIBaseURL at Server.APIURL to run the bot against it.
+type Server struct {
+	// APIURL is the base URL of the fake Web API
+	APIURL    string
+	BotUserID string
+	BotName   string
+
+	server  *httptest.Server
+	lock    sync.Mutex // guards users, conns and replies
+	users   map[string]types.SlackUser
+	conns   map[*websocket.Conn]bool
+	replies []types.Message
+	sent    chan types.Message
+	tsSeq   uint64
+}
+
+// NewServer starts a fake slack on a local port for the bot user botUserID
+func NewServer(botUserID string) *Server {
+	s := &Server{
+		BotUserID: botUserID,
+		BotName:   "fake-bot",
+		users:     make(map[string]types.SlackUser),
+		conns:     make(map[*websocket.Conn]bool),
+		sent:      make(chan types.Message, 256),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/rtm.start", s.handleRTMStart)
+	mux.HandleFunc("/api/auth.test", s.handleAuthTest)
+	mux.HandleFunc("/api/users.list", s.handleUsersList)
+	mux.HandleFunc("/api/users.info", s.handleUsersInfo)
+	mux.HandleFunc("/api/users.lookupByEmail", s.handleUsersLookupByEmail)
+	mux.HandleFunc("/api/chat.postMessage", s.handlePostMessage)
+	mux.HandleFunc("/api/chat.postEphemeral", s.handlePostMessage)
+	mux.HandleFunc("/api/chat.update", s.handleUpdateMessage)
+	mux.HandleFunc("/api/conversations.open", s.handleConversationsOpen)
+	mux.Handle("/ws", websocket.Handler(s.handleWebSocket))
+	s.server = httptest.NewServer(mux)
+	s.APIURL = s.server.URL + "/api"
+	return s
+}
+
+// Close shuts down the fake slack and every web socket connected to it
+func (s *Server) Close() {
+	s.DropConnections()
+	s.server.Close()
+}
+
+// AddUser adds usr to the workspace
+func (s *Server) AddUser(usr types.SlackUser) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.users[usr.ID] = usr
+}
+
+func (s *Server) nextTs() string {
+	seq := atomic.AddUint64(&s.tsSeq, 1)
+	return fmt.Sprintf("%d.%06d", time.Now().Unix(), seq)
+}
+
+// SendMessageAs delivers text posted by user in channel to every connected bot, returning the message ts
+func (s *Server) SendMessageAs(user, channel, text string) string {
+	return s.SendThreadMessageAs(user, channel, "", text)
+}
+
+// SendThreadMessageAs delivers text posted by user in the thread threadTs of channel, returning the message ts
+func (s *Server) SendThreadMessageAs(user, channel, threadTs, text string) string {
+	m := types.Message{
+		Type:     types.MessageType,
+		Channel:  channel,
+		User:     user,
+		Text:     text,
+		Ts:       s.nextTs(),
+		ThreadTs: threadTs,
+	}
+	s.broadcast(m)
+	return m.Ts
+}
+
+// MentionBotAs delivers a message from user in channel that addresses the bot
+func (s *Server) MentionBotAs(user, channel, text string) string {
+	return s.SendMessageAs(user, channel, fmt.Sprintf("<@%s> %s", s.BotUserID, text))
+}
+
+func (s *Server) broadcast(v interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for conn := range s.conns {
+		if err := websocket.JSON.Send(conn, v); err != nil {
+			glog.Errorf("Fake slack failed to deliver message. err=%s\n", err.Error())
+		}
+	}
+}
+
+// DropConnections closes every connected web socket, as slack does when it restarts
+func (s *Server) DropConnections() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+// Connections returns the number of bots connected to the RTM web socket
+func (s *Server) Connections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.conns)
+}
+
+// Replies returns every message the bot has sent so far
+func (s *Server) Replies() []types.Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]types.Message(nil), s.replies...)
+}
+
+// WaitForReply returns the next message the bot sends, failing after timeout
+func (s *Server) WaitForReply(timeout time.Duration) (types.Message, error) {
+	select {
+	case m := <-s.sent:
+		return m, nil
+	case <-time.After(timeout):
+		return types.Message{}, fmt.Errorf("no reply from the bot within %s", timeout)
+	}
+}
+
+func (s *Server) record(m types.Message) {
+	s.lock.Lock()
+	s.replies = append(s.replies, m)
+	s.lock.Unlock()
+	select {
+	case s.sent <- m:
+	default:
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) userList() []types.SlackUser {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	users := make([]types.SlackUser, 0, len(s.users))
+	for _, usr := range s.users {
+		users = append(users, usr)
+	}
+	return users
+}
+
+func (s *Server) handleRTMStart(w http.ResponseWriter, r *http.Request) {
+	resp := types.ResponseRtmStart{
+		Ok:    true,
+		URL:   "ws" + strings.TrimPrefix(s.server.URL, "http") + "/ws",
+		Bot:   types.BotID{ID: s.BotUserID, Name: s.BotName},
+		Users: s.userList(),
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleAuthTest(w http.ResponseWriter, r *http.Request) {
+	var resp types.AuthTestResp
+	resp.Ok = true
+	resp.UserID = s.BotUserID
+	resp.User = s.BotName
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleUsersList(w http.ResponseWriter, r *http.Request) {
+	var resp types.UsersListResp
+	resp.Ok = true
+	resp.Members = s.userList()
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleUsersInfo(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	usr, ok := s.users[r.FormValue("user")]
+	s.lock.Unlock()
+
+	var resp types.UsersInfoResp
+	if !ok {
+		resp.Error = "user_not_found"
+		writeJSON(w, resp)
+		return
+	}
+	resp.Ok = true
+	resp.User = usr
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleUsersLookupByEmail(w http.ResponseWriter, r *http.Request) {
+	var resp types.UsersInfoResp
+	resp.Error = "users_not_found"
+	for _, usr := range s.userList() {
+		if strings.EqualFold(usr.Profile.Email, r.FormValue("email")) {
+			resp.Ok, resp.Error, resp.User = true, "", usr
+			break
+		}
+	}
+	writeJSON(w, resp)
+}
+
+// formMessage returns the message described by the chat.* form parameters of r
+func formMessage(r *http.Request) (m types.Message, err error) {
+	m = types.Message{
+		Type:           types.MessageType,
+		Channel:        r.FormValue("channel"),
+		User:           r.FormValue("user"),
+		Text:           r.FormValue("text"),
+		Ts:             r.FormValue("ts"),
+		ThreadTs:       r.FormValue("thread_ts"),
+		ReplyBroadcast: r.FormValue("reply_broadcast") == "true",
+	}
+	if blocks := r.FormValue("blocks"); blocks != "" {
+		err = json.Unmarshal([]byte(blocks), &m.Blocks)
+	}
+	return
+}
+
+func (s *Server) handlePostMessage(w http.ResponseWriter, r *http.Request) {
+	m, err := formMessage(r)
+	if err != nil {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "invalid_blocks"})
+		return
+	}
+	m.Ts = s.nextTs()
+	s.record(m)
+	writeJSON(w, map[string]interface{}{"ok": true, "channel": m.Channel, "ts": m.Ts})
+}
+
+func (s *Server) handleUpdateMessage(w http.ResponseWriter, r *http.Request) {
+	m, err := formMessage(r)
+	if err != nil {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "invalid_blocks"})
+		return
+	}
+	if m.Ts == "" {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "message_not_found"})
+		return
+	}
+	s.record(m)
+	writeJSON(w, map[string]interface{}{"ok": true, "channel": m.Channel, "ts": m.Ts})
+}
+
+// handleConversationsOpen opens the direct message channel "D<user ID>" with the user
+func (s *Server) handleConversationsOpen(w http.ResponseWriter, r *http.Request) {
+	users := r.FormValue("users")
+	if users == "" || strings.Contains(users, ",") {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "user_not_found"})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"ok": true, "channel": map[string]string{"id": "D" + users}})
+}
+
+func (s *Server) handleWebSocket(conn *websocket.Conn) {
+	s.lock.Lock()
+	s.conns[conn] = true
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+		conn.Close()
+	}()
+
+	websocket.JSON.Send(conn, map[string]string{"type": types.HelloType})
+	for {
+		var m types.Message
+		if err := websocket.JSON.Receive(conn, &m); err != nil {
+			return
+		}
+		switch m.Type {
+		case types.PingType:
+			websocket.JSON.Send(conn, types.Message{Type: types.PongType, ReplyTo: m.ID})
+		case types.MessageType:
+			s.record(m)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package slacktest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/slack"
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func readUserMessage(conn *slack.ServerConn) (types.Message, error) {
+	for {
+		m, err := conn.ReadMessage()
+		if err != nil || m.Type == types.MessageType {
+			return m, err
+		}
+	}
+}
+
+func TestServerWithRTM(t *testing.T) {
+	Convey("A ServerConn connected to the fake slack", t, func() {
+		srv := NewServer("UBOT")
+		defer srv.Close()
+		var usr types.SlackUser
+		usr.ID = "UCRAY7Q"
+		usr.Profile.Email = "john.doe@johndoe.com"
+		srv.AddUser(usr)
+		slack.APIBaseURL = srv.APIURL
+		defer func() { slack.APIBaseURL = types.SlackWebAPIURL }()
+
+		conn, err := slack.NewSlackServerConn("xoxb-unit-test")
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(conn.BotUserID(), ShouldEqual, "UBOT")
+
+		Convey("should learn about the workspace users", func() {
+			actual, err := conn.LookupUser("UCRAY7Q")
+			So(err, ShouldBeNil)
+			So(actual.Profile.Email, ShouldEqual, "john.doe@johndoe.com")
+		})
+		Convey("should receive messages injected as a user", func() {
+			srv.MentionBotAs("UCRAY7Q", "C1", "!help")
+			m, err := readUserMessage(conn)
+			So(err, ShouldBeNil)
+			So(m.User, ShouldEqual, "UCRAY7Q")
+			So(m.Channel, ShouldEqual, "C1")
+			So(m.Text, ShouldEqual, "<@UBOT> !help")
+		})
+		Convey("should record replies sent by the bot", func() {
+			So(conn.SendMessage(types.Message{Type: types.MessageType, Channel: "C1", Text: "hello"}), ShouldBeNil)
+			So(conn.PostToThread("C1", "1503435956.000247", "threaded hello"), ShouldBeNil)
+			first, err := srv.WaitForReply(5 * time.Second)
+			So(err, ShouldBeNil)
+			second, err := srv.WaitForReply(5 * time.Second)
+			So(err, ShouldBeNil)
+			So([]string{first.Text, second.Text}, ShouldContain, "hello")
+			So([]string{first.Text, second.Text}, ShouldContain, "threaded hello")
+		})
+		Convey("should reconnect after slack drops the socket", func() {
+			srv.DropConnections()
+			received := make(chan types.Message, 1)
+			go func() {
+				m, _ := readUserMessage(conn)
+				received <- m
+			}()
+			for srv.Connections() == 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			srv.MentionBotAs("UCRAY7Q", "C1", "!help")
+			select {
+			case m := <-received:
+				So(m.Text, ShouldEqual, "<@UBOT> !help")
+			case <-time.After(5 * time.Second):
+				So("no message after reconnect", ShouldBeEmpty)
+			}
+			So(conn.State(), ShouldEqual, slack.StateConnected)
+		})
+	})
+}
+
+func TestServerWithWebClient(t *testing.T) {
+	Convey("A WebClient talking to the fake slack", t, func() {
+		srv := NewServer("UBOT")
+		defer srv.Close()
+		slack.APIBaseURL = srv.APIURL
+		defer func() { slack.APIBaseURL = types.SlackWebAPIURL }()
+		client := slack.NewWebClient("xoxb-unit-test")
+		blocks := []types.Block{types.NewHeaderBlock("kube2iam role approved"), types.NewSectionBlock("", "*Namespace*\nfoo")}
+
+		Convey("should post threaded messages with blocks and return their ts", func() {
+			ts, err := client.PostMessage(types.Message{Channel: "CHAN", Text: "approved", ThreadTs: "1.000001", ReplyBroadcast: true, Blocks: blocks})
+			So(err, ShouldBeNil)
+			So(ts, ShouldNotBeEmpty)
+
+			reply, err := srv.WaitForReply(time.Second)
+			So(err, ShouldBeNil)
+			So(reply.Ts, ShouldEqual, ts)
+			So(reply.ThreadTs, ShouldEqual, "1.000001")
+			So(reply.ReplyBroadcast, ShouldBeTrue)
+			So(reply.Blocks, ShouldResemble, blocks)
+		})
+		Convey("should update a posted message", func() {
+			err := client.UpdateMessage(types.Message{Channel: "CHAN", Ts: "1.000002", Text: "denied", Blocks: blocks})
+			So(err, ShouldBeNil)
+
+			reply, err := srv.WaitForReply(time.Second)
+			So(err, ShouldBeNil)
+			So(reply.Ts, ShouldEqual, "1.000002")
+			So(reply.Text, ShouldEqual, "denied")
+			So(reply.Blocks, ShouldResemble, blocks)
+		})
+		Convey("should not update a message without its ts", func() {
+			err := client.UpdateMessage(types.Message{Channel: "CHAN", Text: "denied"})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should send direct messages in the user's conversation with the bot", func() {
+			err := client.SendDirectMessage("UCRAY7Q", "your request expired")
+			So(err, ShouldBeNil)
+
+			reply, err := srv.WaitForReply(time.Second)
+			So(err, ShouldBeNil)
+			So(reply.Channel, ShouldEqual, "DUCRAY7Q")
+			So(reply.Text, ShouldEqual, "your request expired")
+		})
+		Convey("should find users by email", func() {
+			var usr types.SlackUser
+			usr.ID = "ULATE"
+			usr.Profile.Email = "late.joiner@johndoe.com"
+			srv.AddUser(usr)
+			actual, err := client.LookupUserByEmail("Late.Joiner@johndoe.com")
+			So(err, ShouldBeNil)
+			So(actual.ID, ShouldEqual, "ULATE")
+
+			_, err = client.LookupUserByEmail("nobody@johndoe.com")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,204 @@
+// Package store records kube2iam requests while they wait for one of the role owners to approve them.
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	"github.com/golang/glog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrRequestNotFound is returned for requests that were never made or are no longer pending
+var ErrRequestNotFound = errors.New("kube2iam request not found")
+
+// RequestStore records pending kube2iam requests
+type RequestStore interface {
+	// Add records req, assigning it an ID and, when it has none, a creation time
+	Add(req types.Kube2IamRequest) (types.Kube2IamRequest, error)
+	Get(id string) (types.Kube2IamRequest, error)
+	// Update replaces the pending request with the same ID as req
+	Update(req types.Kube2IamRequest) error
+	Delete(id string) error
+	// Take removes the pending request id and returns it, so only one caller can claim it
+	Take(id string) (types.Kube2IamRequest, error)
+	// Restore records a request claimed with Take again under its own ID
+	Restore(req types.Kube2IamRequest) error
+	// List returns every pending request, oldest first
+	List() ([]types.Kube2IamRequest, error)
+	Close() error
+}
+
+var requestsBucket = []byte("kube2iamRequests")
+
+// BoltStore is a RequestStore kept in a bolt database file, so pending requests survive restarts of the bot
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var _ RequestStore = &BoltStore{}
+
+// NewBoltStore opens the bolt database at path, creating it when it doesn't exist
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open request store %s, err=%s", path, err.Error())
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(requestsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize request store %s, err=%s", path, err.Error())
+	}
+	glog.V(1).Infof("Opened kube2iam request store %s\n", path)
+	return &BoltStore{db: db}, nil
+}
+
+// requestKey returns the bolt key of the request id. Keys are big endian so requests iterate in the order they were made.
+func requestKey(id string) ([]byte, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrRequestNotFound
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key, nil
+}
+
+// Add records req under the next request ID
+func (s *BoltStore) Add(req types.Kube2IamRequest) (types.Kube2IamRequest, error) {
+	if req.CreatedAt.IsZero() {
+		req.CreatedAt = time.Now()
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(requestsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		req.ID = strconv.FormatUint(seq, 10)
+		raw, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		key, _ := requestKey(req.ID)
+		return b.Put(key, raw)
+	})
+	if err != nil {
+		return req, fmt.Errorf("failed to record kube2iam request, err=%s", err.Error())
+	}
+	return req, nil
+}
+
+// Get returns the pending request id
+func (s *BoltStore) Get(id string) (req types.Kube2IamRequest, err error) {
+	key, err := requestKey(id)
+	if err != nil {
+		return
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(requestsBucket).Get(key)
+		if raw == nil {
+			return ErrRequestNotFound
+		}
+		return json.Unmarshal(raw, &req)
+	})
+	return
+}
+
+// Update replaces the pending request req.ID with req
+func (s *BoltStore) Update(req types.Kube2IamRequest) error {
+	key, err := requestKey(req.ID)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal kube2iam request %s, err=%s", req.ID, err.Error())
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(requestsBucket)
+		if b.Get(key) == nil {
+			return ErrRequestNotFound
+		}
+		return b.Put(key, raw)
+	})
+}
+
+// Delete removes the pending request id
+func (s *BoltStore) Delete(id string) error {
+	key, err := requestKey(id)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(requestsBucket)
+		if b.Get(key) == nil {
+			return ErrRequestNotFound
+		}
+		return b.Delete(key)
+	})
+}
+
+// Take removes the pending request id and returns it. Of concurrent callers taking the same request only one gets it,
+// the others get ErrRequestNotFound.
+func (s *BoltStore) Take(id string) (req types.Kube2IamRequest, err error) {
+	key, err := requestKey(id)
+	if err != nil {
+		return
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(requestsBucket)
+		raw := b.Get(key)
+		if raw == nil {
+			return ErrRequestNotFound
+		}
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return err
+		}
+		return b.Delete(key)
+	})
+	return
+}
+
+// Restore records req, taken when its decision couldn't be carried out, under its ID again
+func (s *BoltStore) Restore(req types.Kube2IamRequest) error {
+	key, err := requestKey(req.ID)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal kube2iam request %s, err=%s", req.ID, err.Error())
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(requestsBucket).Put(key, raw)
+	})
+}
+
+// List returns every pending request in the order they were made
+func (s *BoltStore) List() (reqs []types.Kube2IamRequest, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(requestsBucket).ForEach(func(_, raw []byte) error {
+			var req types.Kube2IamRequest
+			if err := json.Unmarshal(raw, &req); err != nil {
+				return err
+			}
+			reqs = append(reqs, req)
+			return nil
+		})
+	})
+	return
+}
+
+// Close closes the bolt database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashish-amarnath/slackbots/pkg/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBoltStore(t *testing.T) {
+	Convey("BoltStore", t, func() {
+		path := filepath.Join(t.TempDir(), "requests.db")
+		s, err := NewBoltStore(path)
+		So(err, ShouldBeNil)
+		defer func() { s.Close() }()
+		req := types.Kube2IamRequest{
+			Requester: "UCRAY7Q",
+			Namespace: "foo",
+			RoleArn:   "arn:aws:iam::123456789012:role/superawesome-powerful-Role3",
+			Cluster:   "hydrogen",
+			Owners:    []string{"Doe, John"},
+		}
+
+		Convey("should assign increasing IDs and a creation time", func() {
+			first, err := s.Add(req)
+			So(err, ShouldBeNil)
+			So(first.ID, ShouldEqual, "1")
+			So(first.CreatedAt, ShouldNotBeZeroValue)
+			second, err := s.Add(req)
+			So(err, ShouldBeNil)
+			So(second.ID, ShouldEqual, "2")
+		})
+		Convey("should return recorded requests until they are deleted", func() {
+			added, _ := s.Add(req)
+			actual, err := s.Get(added.ID)
+			So(err, ShouldBeNil)
+			So(actual.Namespace, ShouldEqual, "foo")
+			So(actual.Owners, ShouldResemble, []string{"Doe, John"})
+			So(actual.CreatedAt.Equal(added.CreatedAt), ShouldBeTrue)
+
+			So(s.Delete(added.ID), ShouldBeNil)
+			_, err = s.Get(added.ID)
+			So(err, ShouldEqual, ErrRequestNotFound)
+			So(s.Delete(added.ID), ShouldEqual, ErrRequestNotFound)
+		})
+		Convey("should update pending requests only", func() {
+			added, _ := s.Add(req)
+			added.RemindedAt = added.CreatedAt.Add(time.Hour)
+			So(s.Update(added), ShouldBeNil)
+			actual, _ := s.Get(added.ID)
+			So(actual.RemindedAt.Equal(added.RemindedAt), ShouldBeTrue)
+
+			s.Delete(added.ID)
+			So(s.Update(added), ShouldEqual, ErrRequestNotFound)
+		})
+		Convey("should let only one of concurrent callers take a request", func() {
+			added, _ := s.Add(req)
+			var wg sync.WaitGroup
+			var lock sync.Mutex
+			taken := 0
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := s.Take(added.ID); err == nil {
+						lock.Lock()
+						taken++
+						lock.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			So(taken, ShouldEqual, 1)
+			_, err := s.Get(added.ID)
+			So(err, ShouldEqual, ErrRequestNotFound)
+
+			So(s.Restore(added), ShouldBeNil)
+			actual, err := s.Take(added.ID)
+			So(err, ShouldBeNil)
+			So(actual.RoleArn, ShouldEqual, req.RoleArn)
+		})
+		Convey("should not find requests with malformed IDs", func() {
+			_, err := s.Get("../../etc/passwd")
+			So(err, ShouldEqual, ErrRequestNotFound)
+		})
+		Convey("should list requests oldest first", func() {
+			for i := 0; i < 12; i++ {
+				req.CreatedAt = time.Unix(int64(1531420618+i), 0)
+				s.Add(req)
+			}
+			reqs, err := s.List()
+			So(err, ShouldBeNil)
+			So(len(reqs), ShouldEqual, 12)
+			So(reqs[9].ID, ShouldEqual, "10")
+			So(reqs[11].CreatedAt.Unix(), ShouldEqual, 1531420629)
+		})
+		Convey("should keep requests across restarts", func() {
+			added, _ := s.Add(req)
+			So(s.Close(), ShouldBeNil)
+			s, err = NewBoltStore(path)
+			So(err, ShouldBeNil)
+			actual, err := s.Get(added.ID)
+			So(err, ShouldBeNil)
+			So(actual.RoleArn, ShouldEqual, req.RoleArn)
+			next, _ := s.Add(req)
+			So(next.ID, ShouldEqual, "2")
+		})
+	})
+}
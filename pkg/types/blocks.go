@@ -0,0 +1,80 @@
+package types
+
+// Block Kit block and text object types
+const (
+	SectionBlock = "section"
+	DividerBlock = "divider"
+	HeaderBlock  = "header"
+	ActionsBlock = "actions"
+	PlainText    = "plain_text"
+	Markdown     = "mrkdwn"
+	ButtonType   = "button"
+)
+
+// Button styles
+const (
+	PrimaryStyle = "primary"
+	DangerStyle  = "danger"
+)
+
+// TextObject represents a Block Kit text object
+type TextObject struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Block represents a Block Kit layout block
+type Block struct {
+	Type     string         `json:"type"`
+	BlockID  string         `json:"block_id,omitempty"`
+	Text     *TextObject    `json:"text,omitempty"`
+	Fields   []*TextObject  `json:"fields,omitempty"`
+	Elements []BlockElement `json:"elements,omitempty"`
+}
+
+// BlockElement represents an interactive element of an actions block, e.g. a button
+type BlockElement struct {
+	Type     string      `json:"type"`
+	Text     *TextObject `json:"text,omitempty"`
+	ActionID string      `json:"action_id,omitempty"`
+	Value    string      `json:"value,omitempty"`
+	Style    string      `json:"style,omitempty"`
+}
+
+// NewHeaderBlock returns a header block showing text
+func NewHeaderBlock(text string) Block {
+	return Block{Type: HeaderBlock, Text: &TextObject{Type: PlainText, Text: text}}
+}
+
+// NewSectionBlock returns a section block showing the markdown text and fields
+func NewSectionBlock(text string, fields ...string) Block {
+	b := Block{Type: SectionBlock}
+	if text != "" {
+		b.Text = &TextObject{Type: Markdown, Text: text}
+	}
+	for _, f := range fields {
+		b.Fields = append(b.Fields, &TextObject{Type: Markdown, Text: f})
+	}
+	return b
+}
+
+// NewDividerBlock returns a divider block
+func NewDividerBlock() Block {
+	return Block{Type: DividerBlock}
+}
+
+// NewButton returns a button labelled text that sends value with actionID when clicked
+func NewButton(actionID, text, value, style string) BlockElement {
+	return BlockElement{
+		Type:     ButtonType,
+		Text:     &TextObject{Type: PlainText, Text: text},
+		ActionID: actionID,
+		Value:    value,
+		Style:    style,
+	}
+}
+
+// NewActionsBlock returns an actions block identified by blockID holding elements
+func NewActionsBlock(blockID string, elements ...BlockElement) Block {
+	return Block{Type: ActionsBlock, BlockID: blockID, Elements: elements}
+}
@@ -2,18 +2,52 @@ package types
 
 // Constants
 const (
-	SlackRtmURLFmt              = "https://slack.com/api/rtm.start?token=%s"
-	SlackAPIServerURL           = "https://api.slack.com/"
-	MessageType                 = "message"
-	HelpBotReq                  = "!help"
-	HelpBotReqFormat            = "```!help```"
-	RequestKube2IamBotReq       = "!requestKube2iam"
-	RequestKube2IamBotReqFormat = "```!requestKube2iam <namespace> <roleArn> <cluster>```"
-	ApproveKube2IamBotReq       = "!approveKube2iam"
-	ApproveKube2IamBotReqFormat = "```!approveKube2iam <namespace> <roleArn> <cluster>```"
-	Kube2IamBotReqLength        = 5
-	AWSMetaDataServerAccRsrcEp  = "dev_read/accounts?AccountNumber"
-	ADSecurityGroupEndPoint     = "dev_read/teams?ID"
-	AccountNumberIndexInRoleArn = 4
-	WhichKubectl                = "which kubectl"
+	SlackRtmURLFmt               = "%s/rtm.start?token=%s"
+	SlackAPIServerURL            = "https://api.slack.com/"
+	SlackWebAPIURL               = "https://slack.com/api"
+	TransportRTM                 = "rtm"
+	TransportSocketMode          = "socketmode"
+	TransportEvents              = "events"
+	IdentityProviderREST         = "rest"
+	IdentityProviderLDAP         = "ldap"
+	IdentityProviderStatic       = "static"
+	MessageType                  = "message"
+	GoodbyeType                  = "goodbye"
+	PingType                     = "ping"
+	PongType                     = "pong"
+	HelloType                    = "hello"
+	DisconnectType               = "disconnect"
+	EventsAPIType                = "events_api"
+	InteractiveType              = "interactive"
+	BlockActionsType             = "block_actions"
+	URLVerificationType          = "url_verification"
+	EventCallbackType            = "event_callback"
+	AppMentionEvent              = "app_mention"
+	DirectMessageChannelType     = "im"
+	HelpBotReq                   = "!help"
+	HelpBotReqFormat             = "```!help```"
+	RequestKube2IamBotReq        = "!requestKube2iam"
+	RequestKube2IamBotReqFormat  = "```!requestKube2iam <namespace> <roleArn> <cluster>```"
+	ApproveKube2IamBotReq        = "!approveKube2iam"
+	ApproveKube2IamBotReqFormat  = "```!approveKube2iam <requestID>```"
+	RevokeKube2IamBotReq         = "!revokeKube2iam"
+	RevokeKube2IamBotReqFormat   = "```!revokeKube2iam <namespace> <roleArn> <cluster>```"
+	ListKube2IamBotReq           = "!listKube2iam"
+	ListKube2IamBotReqFormat     = "```!listKube2iam <namespace> <cluster>```"
+	ListKube2IamBotReqLength     = 4
+	WhoCanAssumeBotReq           = "!whoCanAssume"
+	WhoCanAssumeBotReqFormat     = "```!whoCanAssume <roleArn>```"
+	WhoCanAssumeBotReqLength     = 3
+	ListKube2IamReqsBotReq       = "!myKube2iamRequests"
+	ListKube2IamReqsBotReqFormat = "```!myKube2iamRequests```"
+	FlushCacheBotReq             = "!flushCache"
+	FlushCacheBotReqFormat       = "```!flushCache [accounts|teams|groups|users] [<key>]```"
+	Kube2IamBotReqLength         = 5
+	ApproveKube2IamBotReqLength  = 3
+	Kube2IamRequestBlockID       = "kube2iam_request"
+	ApproveKube2IamAction        = "approve_kube2iam"
+	DenyKube2IamAction           = "deny_kube2iam"
+	AWSMetaDataServerAccRsrcEp   = "dev_read/accounts?AccountNumber"
+	ADSecurityGroupEndPoint      = "dev_read/teams?ID"
+	AccountNumberIndexInRoleArn  = 4
 )
@@ -0,0 +1,125 @@
+package types
+
+import "encoding/json"
+
+// WebAPIResponse represents the fields common to all slack Web API responses
+type WebAPIResponse struct {
+	Ok               bool   `json:"ok"`
+	Error            string `json:"error"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+// AuthTestResp represents the response from auth.test
+type AuthTestResp struct {
+	WebAPIResponse
+	UserID string `json:"user_id"`
+	User   string `json:"user"`
+	TeamID string `json:"team_id"`
+	BotID  string `json:"bot_id"`
+}
+
+// UsersListResp represents a page of the response from users.list
+type UsersListResp struct {
+	WebAPIResponse
+	Members []SlackUser `json:"members"`
+}
+
+// UsersInfoResp represents the response from users.info
+type UsersInfoResp struct {
+	WebAPIResponse
+	User SlackUser `json:"user"`
+}
+
+// ConnectionsOpenResp represents the response from apps.connections.open
+type ConnectionsOpenResp struct {
+	WebAPIResponse
+	URL string `json:"url"`
+}
+
+// ConversationsOpenResp represents the response to conversations.open
+type ConversationsOpenResp struct {
+	WebAPIResponse
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+}
+
+// PostMessageResp represents the response to chat.postMessage
+type PostMessageResp struct {
+	WebAPIResponse
+	Channel string `json:"channel"`
+	Ts      string `json:"ts"`
+}
+
+// SocketModeEnvelope represents a message received over a Socket Mode web socket
+type SocketModeEnvelope struct {
+	EnvelopeID             string          `json:"envelope_id"`
+	Type                   string          `json:"type"`
+	Reason                 string          `json:"reason"`
+	Payload                json.RawMessage `json:"payload"`
+	AcceptsResponsePayload bool            `json:"accepts_response_payload"`
+	RetryAttempt           int             `json:"retry_attempt"`
+}
+
+// SocketModeAck represents the acknowledgement of a Socket Mode envelope
+type SocketModeAck struct {
+	EnvelopeID string `json:"envelope_id"`
+}
+
+// URLVerification represents the challenge slack sends when an Events API request URL is configured
+type URLVerification struct {
+	Type      string `json:"type"`
+	Token     string `json:"token"`
+	Challenge string `json:"challenge"`
+}
+
+// EventCallback represents the outer event sent by the Events API
+type EventCallback struct {
+	Token     string `json:"token"`
+	TeamID    string `json:"team_id"`
+	Type      string `json:"type"`
+	EventID   string `json:"event_id"`
+	EventTime int64  `json:"event_time"`
+	Event     Event  `json:"event"`
+}
+
+// Event represents the inner event of an Events API callback
+type Event struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	Ts          string `json:"ts"`
+	ThreadTs    string `json:"thread_ts"`
+	EventTs     string `json:"event_ts"`
+}
+
+// InteractionCallback represents the payload sent when a user interacts with a message, e.g. clicks a button
+type InteractionCallback struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Channel struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"channel"`
+	Message struct {
+		Ts   string `json:"ts"`
+		Text string `json:"text"`
+	} `json:"message"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		BlockID  string `json:"block_id"`
+		Value    string `json:"value"`
+		Type     string `json:"type"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+	TriggerID   string `json:"trigger_id"`
+}
@@ -0,0 +1,18 @@
+package types
+
+import "time"
+
+// Kube2IamRequest represents a request to allow a namespace to assume a role, pending approval by one of the role owners
+type Kube2IamRequest struct {
+	ID        string   `json:"id"`
+	Requester string   `json:"requester"`
+	Namespace string   `json:"namespace"`
+	RoleArn   string   `json:"roleArn"`
+	Cluster   string   `json:"cluster"`
+	Owners    []string `json:"owners"`
+	// OwnerEmails are the emails of the owners, by which they are found in slack
+	OwnerEmails []string  `json:"ownerEmails,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// RemindedAt is when the owners were last reminded of the request
+	RemindedAt time.Time `json:"remindedAt,omitempty"`
+}
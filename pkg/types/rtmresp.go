@@ -19,14 +19,26 @@ type BotID struct {
 
 // Message represents messages written to and read from web socket.
 type Message struct {
-	ID      uint64 `json:"id"`
-	Type    string `json:"type"`
-	Channel string `json:"channel"`
-	Text    string `json:"text"`
-	User    string `json:"user"`
+	ID             uint64  `json:"id"`
+	Type           string  `json:"type"`
+	Channel        string  `json:"channel"`
+	Text           string  `json:"text"`
+	User           string  `json:"user"`
+	ReplyTo        uint64  `json:"reply_to,omitempty"`
+	Ts             string  `json:"ts,omitempty"`
+	ThreadTs       string  `json:"thread_ts,omitempty"`
+	ReplyBroadcast bool    `json:"reply_broadcast,omitempty"`
+	Blocks         []Block `json:"blocks,omitempty"`
 }
 
-//AccNumRespMsg represents the response from the accountOwnerIDRequest endpoint
+// Ping represents a keepalive ping written to the web socket
+type Ping struct {
+	ID   uint64 `json:"id"`
+	Type string `json:"type"`
+	Time int64  `json:"time"`
+}
+
+// AccNumRespMsg represents the response from the accountOwnerIDRequest endpoint
 type AccNumRespMsg struct {
 	Data []struct {
 		EnvironmentID     int    `json:"EnvironmentId"`
@@ -60,8 +72,8 @@ type ADGroupMemberListResp struct {
 	Email       string `json:"email"`
 	Type        string `json:"type"`
 	Members     struct {
-		Groups []interface{} `json:"groups"`
-		Users  []string      `json:"users"`
+		Groups []string `json:"groups"`
+		Users  []string `json:"users"`
 	} `json:"members"`
 	ManagedBy struct {
 		Group interface{} `json:"group"`
@@ -97,6 +109,13 @@ type KubernetesNamespace struct {
 	} `json:"status"`
 }
 
+// KubernetesNamespaceList represents a list of k8s namespaces
+type KubernetesNamespaceList struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Items      []KubernetesNamespace `json:"items"`
+}
+
 // SlackUser represents a slack user
 type SlackUser struct {
 	ID       string `json:"id"`
@@ -148,5 +167,6 @@ type BotReqParams struct {
 	AWSAPIKey            string
 	KubeConfig           string
 	Message              string
+	Fields               []string // the words of Message
 	SlackUser            string
 }
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ashish-amarnath/slackbots/pkg/types"
 	. "github.com/smartystreets/goconvey/convey"
@@ -29,25 +31,6 @@ func TestStringifyMessage(t *testing.T) {
 	})
 }
 
-func TestRunBashCmd(t *testing.T) {
-	Convey("RunBashCmd", t, func() {
-		Convey("should successfully run invoked with a valid bash command string", func() {
-			validBashCmd := "echo this should pass"
-			expected := "this should pass"
-			actual, err := RunBashCmd(validBashCmd)
-			So(err, ShouldBeNil)
-			So(actual, ShouldResemble, expected)
-		})
-		Convey("should fail when invoked with an invalid bash command string", func() {
-			invalidBashCmd := "whatwasithinking"
-			expected := ""
-			actual, err := RunBashCmd(invalidBashCmd)
-			So(err, ShouldNotBeNil)
-			So(actual, ShouldResemble, expected)
-		})
-	})
-}
-
 func TestStringifySlackUser(t *testing.T) {
 	Convey("StringifySlackUser", t, func() {
 		Convey("Should return expected string version of a SlackUser object", func() {
@@ -94,9 +77,16 @@ func TestGetBotReqType(t *testing.T) {
 	Convey("GetBotReqType should parse and return the type of request", t, func() {
 		msg := "@superbot !doSomethingAwesome foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen"
 		expected := "!doSomethingAwesome"
-		actual := GetBotReqType(msg)
+		actual := GetBotReqType(strings.Fields(msg))
 		So(actual, ShouldResemble, expected)
 	})
+	Convey("GetBotReqType should return no type for messages without one", t, func() {
+		So(GetBotReqType(nil), ShouldEqual, "")
+		So(GetBotReqType(strings.Fields("   ")), ShouldEqual, "")
+		So(GetBotReqType(strings.Fields("<@UBOT>")), ShouldEqual, "")
+		So(GetBotReqType(strings.Fields("<@UBOT> ")), ShouldEqual, "")
+		So(GetBotReqType(strings.Fields("<@UBOT>  !help")), ShouldEqual, "!help")
+	})
 }
 
 func TestGetBotReqParams(t *testing.T) {
@@ -107,7 +97,8 @@ func TestGetBotReqParams(t *testing.T) {
 		expected.AWSAPIKey = "masterkey"
 		expected.AWSMetadataServerURL = "https://jibberish.execute-api.us-west-81.amazonaws.com"
 		expected.KubeConfig = "/User/craycrayuser/.kube/config"
-		expected.Message = "@superbot !doSomethingAwesome foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen"
+		expected.Message = "@superbot  !doSomethingAwesome foo arn:aws:iam::123456789012:role/superawesome-powerful-Role3 hydrogen "
+		expected.Fields = []string{"@superbot", "!doSomethingAwesome", "foo", "arn:aws:iam::123456789012:role/superawesome-powerful-Role3", "hydrogen"}
 		expected.SlackUser = "UCRAY7Q"
 
 		actual := GetBotReqParams(expected.ADGroupLookupURL, expected.ADUserLookupURL, expected.AWSMetadataServerURL, expected.AWSAPIKey, expected.KubeConfig, expected.Message, expected.SlackUser)
@@ -131,3 +122,20 @@ func TestStringifyBotReqParams(t *testing.T) {
 		So(actual, ShouldResemble, expected)
 	})
 }
+
+func TestStringifyKube2IamRequest(t *testing.T) {
+	Convey("StringifyKube2IamRequest should return a right representation of a Kube2IamRequest struct", t, func() {
+		var to types.Kube2IamRequest
+		to.ID = "7"
+		to.Requester = "UCRAY7Q"
+		to.Namespace = "foo"
+		to.RoleArn = "arn:aws:iam::123456789012:role/superawesome-powerful-Role3"
+		to.Cluster = "hydrogen"
+		to.Owners = []string{"Doe, John", "Doe, Jane"}
+		to.CreatedAt = time.Unix(1531420618, 0).UTC()
+
+		expected := `[ID=[7], Requester=[UCRAY7Q], Namespace=[foo], RoleArn=[arn:aws:iam::123456789012:role/superawesome-powerful-Role3], Cluster=[hydrogen], Owners=[Doe, John; Doe, Jane], CreatedAt=[2018-07-12T18:36:58Z]]`
+		actual := StringifyKube2IamRequest(to)
+		So(actual, ShouldResemble, expected)
+	})
+}